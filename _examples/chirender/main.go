@@ -18,8 +18,6 @@ import (
 //go:embed files
 var embeddedFiles embed.FS
 
-const useEmbeddedFS = false
-
 // --- Data Structures ---
 type Person struct {
 	Name string `json:"name"`
@@ -42,15 +40,15 @@ func main() {
 	render.Respond = chirender.HTML
 
 	// --- Template Engine Setup ---
-	var tmpls *templates.Templates
-	if useEmbeddedFS {
-		log.Println("Using embedded filesystem for templates (production mode)")
-		tmpls = templates.New(&embeddedFiles, nil)
-	} else {
+	// Build with `-tags dev` to read from the local "files" dir with
+	// AlwaysReloadAndParseTemplates on; without it, templates are served
+	// from the embedded FS above. See templates.NewFromBuildMode.
+	if templates.DevMode() {
 		log.Println("Using local filesystem for templates (development mode)")
-		tmpls = templates.New(nil, nil)
-		tmpls.AlwaysReloadAndParseTemplates = true
+	} else {
+		log.Println("Using embedded filesystem for templates (production mode)")
 	}
+	tmpls := templates.NewFromBuildMode(&embeddedFiles, nil)
 	tmpls.MustParseTemplates()
 
 	// --- Mock Data ---
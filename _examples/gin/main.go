@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"log"
 	"net/http"
@@ -15,8 +16,6 @@ import (
 //go:embed files
 var embeddedFiles embed.FS
 
-const useEmbeddedFS = false
-
 // --- Data Structures ---
 type Person struct {
 	Name string
@@ -36,16 +35,16 @@ type CMSPageData struct {
 // --- Main Application ---
 func main() {
 	// --- Template Engine Setup ---
-	var tmpls *templates.Templates
-	if useEmbeddedFS {
-		log.Println("Using embedded filesystem for templates (production mode)")
-		tmpls = templates.New(&embeddedFiles, nil)
-	} else {
+	// Build with `-tags dev` to read from the local "files" dir with
+	// AlwaysReloadAndParseTemplates on; without it, templates are served
+	// from the embedded FS above. See templates.NewFromBuildMode.
+	if templates.DevMode() {
 		log.Println("Using local filesystem for templates (development mode)")
 		gin.SetMode(gin.DebugMode)
-		tmpls = templates.New(nil, nil)
-		tmpls.AlwaysReloadAndParseTemplates = true
+	} else {
+		log.Println("Using embedded filesystem for templates (production mode)")
 	}
+	tmpls := templates.NewFromBuildMode(&embeddedFiles, nil)
 	tmpls.MustParseTemplates()
 
 	// --- Mock Data ---
@@ -65,7 +64,8 @@ func main() {
 
 	// --- Gin Instance Setup ---
 	router := gin.Default()
-	router.HTMLRender = templates_gin.New(tmpls)
+	renderer := templates_gin.New(tmpls)
+	router.HTMLRender = renderer
 
 	// --- Routes ---
 	router.GET("/", func(c *gin.Context) {
@@ -84,11 +84,19 @@ func main() {
 		c.HTML(http.StatusOK, "cms_page", cmsData)
 	})
 
-	// NOTE: Gin's c.HTML() render interface does not provide access to the
-	// http.Request context, so middleware-based layout switching is not supported.
-	// You must explicitly specify the layout in the render call.
-	router.GET("/admin/dashboard", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "special:person", &Person{Name: "Admin (Gin explicit layout)", Age: 104})
+	// Gin's c.HTML() goes through render.HTMLRender, which never sees
+	// *gin.Context, so middleware-based layout switching can't work through
+	// it. renderer.Render(c, status, name, data) propagates c.Request
+	// instead, so a middleware setting LayoutContextKey works the same way
+	// it does for chi/chirender/echo.
+	admin := router.Group("/admin")
+	admin.Use(func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), templates.LayoutContextKey{}, "special")
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	})
+	admin.GET("/dashboard", func(c *gin.Context) {
+		renderer.Render(c, http.StatusOK, "person", &Person{Name: "Admin (from Gin context)", Age: 101})
 	})
 
 	// --- Start Server ---
@@ -15,9 +15,6 @@ import (
 //go:embed files
 var embeddedFiles embed.FS
 
-// Set this to true to simulate a production environment using embedded files.
-const useEmbeddedFS = false
-
 // --- Data Structures for Templates ---
 type Person struct {
 	Name string
@@ -37,19 +34,19 @@ type CMSPageData struct {
 // --- Main Application ---
 func main() {
 	// --- Template Engine Setup ---
-	var tmpls *templates.Templates
-	if useEmbeddedFS {
-		log.Println("Using embedded filesystem for templates (production mode)")
-		tmpls = templates.New(&embeddedFiles, nil)
-	} else {
+	// Build with `-tags dev` to read from the local "files" dir with
+	// AlwaysReloadAndParseTemplates on; without it, templates are served
+	// from the embedded FS above. See templates.NewFromBuildMode.
+	if templates.DevMode() {
 		// This check helps users diagnose if they haven't set up the examples correctly.
 		if _, err := os.Stat("files/templates"); os.IsNotExist(err) {
 			log.Fatalf("FATAL: 'files/templates' directory not found. Please run `make setup-examples` from the project root.")
 		}
 		log.Println("Using local filesystem for templates (development mode)")
-		tmpls = templates.New(nil, nil)
-		tmpls.AlwaysReloadAndParseTemplates = true
+	} else {
+		log.Println("Using embedded filesystem for templates (production mode)")
 	}
+	tmpls := templates.NewFromBuildMode(&embeddedFiles, nil)
 	tmpls.MustParseTemplates()
 	template := stdlib.FromTemplates(tmpls)
 
@@ -0,0 +1,55 @@
+package templates
+
+// CMSField is implemented by a typed value coming from a headless CMS that
+// knows, for itself, which trusted_* conversion (see addTrustedConverterFuncs)
+// its own content is safe for -- so a page can pass it straight to
+// auto_trusted instead of picking the matching trusted_* call by hand for
+// every field.
+type CMSField interface {
+	// TrustedKind reports which conversion Value is safe for: "html",
+	// "script", "style", "stylesheet", "url", "resource_url" or
+	// "identifier". Any other value makes auto_trusted return Value
+	// unconverted, which safehtml's context-aware escaping then treats as
+	// untrusted plain text.
+	TrustedKind() string
+	Value() string
+}
+
+// AddAutoTrustedFuncMapHelper adds the 'auto_trusted' function to the
+// FuncMap: `{{ auto_trusted .Body }}` dispatches a CMSField to the trusted_*
+// conversion its own TrustedKind names, the same conversions
+// addTrustedConverterFuncs registers individually. It requires
+// addTrustedConverterFuncs to have already run (true by default, via
+// AddHeadlessCMSFuncMapHelpers).
+func (t *Templates) AddAutoTrustedFuncMapHelper() {
+	_, ok := t.funcMap["auto_trusted"]
+	if ok {
+		t.Logger.Error("function name is already in use in FuncMap", "name", "auto_trusted")
+		panic("function name 'auto_trusted' is already in use in FuncMap")
+	}
+	t.funcMap["auto_trusted"] = autoTrusted
+}
+
+func autoTrusted(field CMSField) any {
+	if field == nil {
+		return ""
+	}
+	switch field.TrustedKind() {
+	case "html":
+		return trustedHTML(field.Value())
+	case "script":
+		return trustedScript(field.Value())
+	case "style":
+		return trustedStyle(field.Value())
+	case "stylesheet":
+		return trustedStyleSheet(field.Value())
+	case "url":
+		return trustedURL(field.Value())
+	case "resource_url":
+		return trustedResourceURL(field.Value())
+	case "identifier":
+		return trustedIdentifier(field.Value())
+	default:
+		return field.Value()
+	}
+}
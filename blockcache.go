@@ -0,0 +1,60 @@
+package templates
+
+import (
+	"time"
+
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/uncheckedconversions"
+)
+
+// Cached block entries are invalidated the same way page-level entries are:
+// wholesale, by LRUCache.reset on the next ParseTemplates (e.g. every
+// reload while AlwaysReloadAndParseTemplates is set), rather than per-block
+// by a content hash of that block and whatever it transitively includes.
+// That finer-grained tracking isn't something ParsedTemplate exposes today
+// -- see Engine -- so a block whose own file is unchanged but that includes
+// another block which did change is covered the same way any other stale
+// cache entry is: call LRUCache.Purge for the affected block(s), or accept
+// the ttl passed to d_block_cached as the upper bound on staleness.
+
+// RenderBlockAsHTMLStringCached is RenderBlockAsHTMLString, serving and
+// populating t.Cache under the key blockname+"|"+cacheKey when t.Cache is
+// set, instead of always re-executing the block. It falls back to a plain,
+// uncached RenderBlockAsHTMLString when t.Cache is nil. See d_block_cached
+// for the template-facing helper this backs, and LRUCache.Purge to
+// invalidate every cached render of one block at once.
+func (t *Templates) RenderBlockAsHTMLStringCached(blockname string, payload interface{}, cacheKey string, ttl time.Duration) (safehtml.HTML, error) {
+	if t.Cache == nil {
+		return t.RenderBlockAsHTMLString(blockname, payload)
+	}
+	key := blockname + "|" + cacheKey
+	if cached, hit := t.Cache.get(key); hit {
+		return uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract(string(cached)), nil
+	}
+	html, err := t.RenderBlockAsHTMLString(blockname, payload)
+	if err != nil {
+		return html, err
+	}
+	t.Cache.set(key, []byte(html.String()), ttl)
+	return html, nil
+}
+
+// AddDynamicCachedBlockToFuncMap adds the 'd_block_cached' function to the
+// FuncMap -- the cached sibling of d_block:
+//
+//	{{ d_block_cached "_pricing_table" .Data "pricing-table" .CacheTTL }}
+//
+// renders the named block exactly as d_block does, but serves and populates
+// t.Cache under "<blockname>|<cache-key>" for the given ttl (a
+// time.Duration, here .CacheTTL from the page's data), instead of
+// re-executing it on every request. It has no effect until t.Cache is set,
+// e.g. via NewLRUCache -- useful for an expensive block driven by a
+// headless CMS that rarely changes.
+func (t *Templates) AddDynamicCachedBlockToFuncMap() {
+	_, ok := t.funcMap["d_block_cached"]
+	if ok {
+		t.Logger.Error("function name is already in use in FuncMap", "name", "d_block_cached")
+		panic("function name 'd_block_cached' is already in use in FuncMap")
+	}
+	t.funcMap["d_block_cached"] = t.RenderBlockAsHTMLStringCached
+}
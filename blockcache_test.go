@@ -0,0 +1,58 @@
+// ==== File: blockcache_test.go ====
+package templates
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_RenderBlockAsHTMLStringCached(t *testing.T) {
+	tmpls := New(nil, nil)
+	tmpls.MustParseTemplates()
+	tmpls.Cache = NewLRUCache(10)
+
+	render := func() (string, error) {
+		res, err := tmpls.RenderBlockAsHTMLStringCached("_sample_block", "test", "my-key", time.Minute)
+		return res.String(), err
+	}
+
+	first, err := render()
+	if err != nil {
+		t.Fatalf("first render: %v", err)
+	}
+	if !strings.Contains(first, "Sample-Block:test") {
+		t.Fatalf("expected rendered block content, got %q", first)
+	}
+
+	second, err := render()
+	if err != nil {
+		t.Fatalf("second render: %v", err)
+	}
+	if second != first {
+		t.Errorf("expected cached render to match the first, got %q vs %q", second, first)
+	}
+
+	stats := tmpls.Cache.Stats()
+	if stats.Hits != 1 {
+		t.Errorf("expected exactly one cache hit, got %d", stats.Hits)
+	}
+
+	tmpls.Cache.Purge("_sample_block")
+	if _, hit := tmpls.Cache.get("_sample_block|my-key"); hit {
+		t.Error("expected Purge to remove the cached entry")
+	}
+}
+
+func Test_RenderBlockAsHTMLStringCached_NoCache(t *testing.T) {
+	tmpls := New(nil, nil)
+	tmpls.MustParseTemplates()
+
+	res, err := tmpls.RenderBlockAsHTMLStringCached("_sample_block", "test", "my-key", time.Minute)
+	if err != nil {
+		t.Fatalf("render without a cache configured: %v", err)
+	}
+	if !strings.Contains(res.String(), "Sample-Block:test") {
+		t.Errorf("expected rendered block content, got %q", res.String())
+	}
+}
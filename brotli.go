@@ -0,0 +1,23 @@
+//go:build brotli
+
+package templates
+
+import (
+	"bytes"
+
+	"github.com/andybalholm/brotli"
+)
+
+func init() {
+	brotliEncode = func(body []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		w := brotli.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !brotli
+
+package templates
+
+// This build excludes brotli support; negotiateEncoding falls back to gzip
+// since brotliEncode (declared in compression.go) is left nil. Build with
+// -tags brotli to pull in brotli.go and its github.com/andybalholm/brotli
+// dependency instead.
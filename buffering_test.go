@@ -0,0 +1,69 @@
+package templates
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newMidRenderFailureFixture builds a page whose block writes some output
+// before hitting a missing field, so a naive unbuffered renderer would leave
+// "BEFORE" on the wire before failing.
+func newMidRenderFailureFixture(t *testing.T) *Templates {
+	tmpDir, err := ioutil.TempDir("", "buffering")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	layoutsDir := filepath.Join(tmpDir, "layouts")
+	pagesDir := filepath.Join(tmpDir, "pages")
+	blocksDir := filepath.Join(tmpDir, "blocks")
+	os.MkdirAll(layoutsDir, 0755)
+	os.MkdirAll(pagesDir, 0755)
+	os.MkdirAll(blocksDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutsDir, "custom.gohtml"), []byte(`{{define "layout"}}{{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "broken.gohtml"), []byte(`{{define "page"}}{{template "frag" .}}{{end}}{{define "frag"}}BEFORE{{.NoSuchField}}AFTER{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+	return tmpls
+}
+
+func Test_RenderFragmentWithStatus_NoPartialBodyOnError(t *testing.T) {
+	tmpls := newMidRenderFailureFixture(t)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+
+	err := tmpls.RenderFragmentWithStatus(rec, req, 200, "custom:broken", "frag", struct{ Name string }{"World"})
+	if err == nil {
+		t.Fatal("expected an error from a template referencing a nonexistent field")
+	}
+	if body := rec.Body.String(); body != "" {
+		t.Errorf("expected no bytes written to the client on a render error, got %q", body)
+	}
+	if rec.Code != 200 {
+		t.Errorf("expected the default recorder status (no WriteHeader call), got %d", rec.Code)
+	}
+}
+
+func Test_BufferedResponseWriter_MaxBufferSize(t *testing.T) {
+	tmpls := New(nil, nil)
+	tmpls.MaxBufferSize = 4
+
+	rec := httptest.NewRecorder()
+	bw := tmpls.NewBufferedResponseWriter(rec)
+
+	if _, err := bw.Write([]byte("12345")); err == nil {
+		t.Fatal("expected Write to fail once MaxBufferSize is exceeded")
+	}
+	bw.Release()
+}
@@ -0,0 +1,183 @@
+package templates
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheRule decides whether a page's rendered output should be cached for a
+// given request, and if so under which key and for how long. It is
+// registered per page via CacheTemplate. Returning ok == false skips the
+// cache entirely for that request.
+type CacheRule func(r *http.Request) (key string, ttl time.Duration, ok bool)
+
+// Cacheable is implemented by a data value passed to ExecuteTemplate to opt
+// that page into t.Cache without registering a page-specific CacheRule via
+// CacheTemplate. It's the right fit for data that's identical for every
+// visitor (e.g. a public blog post resolved from a slug) -- unlike a
+// CacheRule, which inspects the request, CacheKey only sees the data itself,
+// so it can't accidentally cache per-user content keyed by something that
+// looks safe but isn't (e.g. a query string without the session in it). A
+// CacheRule registered for the page takes precedence over this.
+type Cacheable interface {
+	// CacheKey returns the cache key and TTL to use, and whether this value
+	// should be cached at all.
+	CacheKey() (key string, ttl time.Duration, ok bool)
+}
+
+// CacheStats reports cumulative counters for an LRUCache.
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+type cacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time // zero means no expiry
+}
+
+// LRUCache is a fixed-size, in-process cache of fully-rendered template
+// output, used by Templates.ExecuteTemplate for pages registered via
+// CacheTemplate. It is safe for concurrent use.
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front = most recently used
+	items    map[string]*list.Element
+	stats    CacheStats
+}
+
+// NewLRUCache creates an LRUCache holding at most capacity entries, evicting
+// the least-recently-used entry once it is full.
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRUCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element, capacity),
+	}
+}
+
+func (c *LRUCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		c.stats.Misses++
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	c.stats.Hits++
+	return entry.value, true
+}
+
+func (c *LRUCache) set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*cacheEntry).value = value
+		elem.Value.(*cacheEntry).expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	elem := c.order.PushFront(&cacheEntry{key: key, value: value, expiresAt: expiresAt})
+	c.items[key] = elem
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// Bust removes the given keys from the cache, e.g. after a handler mutates
+// the data backing a cached page. Unknown keys are ignored.
+func (c *LRUCache) Bust(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := c.items[key]; ok {
+			c.order.Remove(elem)
+			delete(c.items, key)
+		}
+	}
+}
+
+// Purge removes every entry RenderBlockAsHTMLStringCached stored for
+// blockName (i.e. every "<blockName>|..." key), e.g. after a handler
+// changes whatever content-managed data that block rendered from. It has no
+// effect on page-level entries cached via CacheTemplate/Cacheable, which
+// don't use that key scheme.
+func (c *LRUCache) Purge(blockName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prefix := blockName + "|"
+	for key, elem := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.order.Remove(elem)
+			delete(c.items, key)
+		}
+	}
+}
+
+// Stats returns a snapshot of the cache's cumulative hit/miss/eviction counters.
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// reset clears all cached entries without touching the cumulative stats. It
+// is called by ParseTemplates so a reload (e.g. AlwaysReloadAndParseTemplates
+// in dev mode) can't serve output rendered with the previous template set.
+func (c *LRUCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element, c.capacity)
+}
+
+// CacheTemplate marks pageName as cacheable: ExecuteTemplate will call rule
+// for every request targeting that page and, if it reports ok, serve and
+// populate t.Cache instead of always re-rendering. CacheTemplate has no
+// effect until t.Cache is set, e.g. via NewLRUCache. A page with no
+// CacheTemplate rule is still cacheable if its data implements Cacheable.
+//
+//	tmpls.Cache = templates.NewLRUCache(1000)
+//	tmpls.CacheTemplate("home", func(r *http.Request) (string, time.Duration, bool) {
+//		return "home:" + r.URL.RawQuery, 5 * time.Minute, true
+//	})
+func (t *Templates) CacheTemplate(pageName string, rule CacheRule) {
+	if t.cacheRules == nil {
+		t.cacheRules = map[string]CacheRule{}
+	}
+	t.cacheRules[pageName] = rule
+}
@@ -0,0 +1,210 @@
+package templates
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressionMode controls whether ExecuteTemplate buffers its output to add
+// an ETag and negotiate a compressed response body.
+type CompressionMode int
+
+const (
+	// CompressionOff streams ExecuteTemplate's output to w as it is rendered,
+	// the historical behavior.
+	CompressionOff CompressionMode = iota
+
+	// CompressionAuto buffers ExecuteTemplate's output, sets a strong ETag
+	// and a "Cache-Control: no-cache" over it, answers a matching
+	// If-None-Match with 304 Not Modified, and otherwise negotiates
+	// Accept-Encoding (gzip, or br when this binary is built with the
+	// "brotli" tag) before writing the body.
+	CompressionAuto
+)
+
+var gzipWriterPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// brotliEncode is nil unless this binary is built with the "brotli" build
+// tag, in which case brotli.go installs a real implementation backed by
+// github.com/andybalholm/brotli. negotiateEncoding falls back to gzip when
+// it's nil.
+var brotliEncode func([]byte) ([]byte, error)
+
+// compressAndWrite writes body to rw, honoring If-None-Match and negotiating
+// Accept-Encoding, per Templates.Compression. r may be nil, in which case no
+// conditional-GET or compression negotiation is possible and body is written
+// as-is. status of 0 means "don't call WriteHeader" -- leave whatever status
+// the caller already staged on rw (e.g. Gin stages its status separately
+// from instance.Render) to take effect on the first Write. Used directly by
+// ExecuteTemplate, and by BufferedResponseWriter.Finish on behalf of
+// framework integrations that need to pick their own status code.
+func (t *Templates) compressAndWrite(rw http.ResponseWriter, r *http.Request, status int, body []byte) error {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	header := rw.Header()
+	header.Set("ETag", etag)
+	header.Add("Vary", "Accept-Encoding")
+	if header.Get("Cache-Control") == "" {
+		// Pairs with the ETag above: tell caches to always revalidate via
+		// If-None-Match instead of serving a stale copy, rather than not
+		// caching at all.
+		header.Set("Cache-Control", "no-cache")
+	}
+
+	if r != nil && ifNoneMatchSatisfied(r.Header.Get("If-None-Match"), etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	encoding, encode := negotiateEncoding(r)
+	if encode != nil {
+		if compressed, err := encode(body); err == nil {
+			header.Set("Content-Encoding", encoding)
+			header.Set("Content-Length", strconv.Itoa(len(compressed)))
+			if status != 0 {
+				rw.WriteHeader(status)
+			}
+			_, err := rw.Write(compressed)
+			return err
+		}
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	if status != 0 {
+		rw.WriteHeader(status)
+	}
+	_, err := rw.Write(body)
+	return err
+}
+
+// BufferedResponseWriter wraps an http.ResponseWriter, capturing everything
+// written to it in a pooled buffer instead of sending it immediately. This
+// lets a framework integration render a template, see whether it errored,
+// and only then commit a status code and body -- so a render failure never
+// leaves a partial response on the wire -- and lets Finish apply
+// Templates.Compression to the complete body. Framework integrations that
+// need an explicit status code (chi, gin, chirender) use this instead of
+// writing straight to their http.ResponseWriter.
+type BufferedResponseWriter struct {
+	http.ResponseWriter
+	buf     *bytes.Buffer
+	maxSize int
+}
+
+// NewBufferedResponseWriter returns a BufferedResponseWriter wrapping w,
+// borrowing its buffer from a shared pool and capping it at
+// t.MaxBufferSize (0 means unbounded). Call Finish (on success) or Release
+// (on failure) exactly once to return the buffer to the pool.
+func (t *Templates) NewBufferedResponseWriter(w http.ResponseWriter) *BufferedResponseWriter {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return &BufferedResponseWriter{ResponseWriter: w, buf: buf, maxSize: t.MaxBufferSize}
+}
+
+// Write implements io.Writer by appending to the buffer instead of w. It
+// fails once the buffer would grow past maxSize, instead of letting a
+// runaway template (e.g. an unbounded {{range}}) buffer without limit.
+func (b *BufferedResponseWriter) Write(p []byte) (int, error) {
+	if b.maxSize > 0 && b.buf.Len()+len(p) > b.maxSize {
+		return 0, fmt.Errorf("templates: buffered response exceeds MaxBufferSize (%d bytes)", b.maxSize)
+	}
+	return b.buf.Write(p)
+}
+
+// WriteHeader is a no-op: nothing defined in this package calls it while
+// rendering into a BufferedResponseWriter, and the status Finish is given
+// always wins over anything rendering code might try to set.
+func (b *BufferedResponseWriter) WriteHeader(int) {}
+
+// Release returns the buffer to the pool without writing anything to the
+// wrapped ResponseWriter. Call this when rendering failed and the caller
+// will respond some other way (e.g. an error page).
+func (b *BufferedResponseWriter) Release() {
+	bufferPool.Put(b.buf)
+	b.buf = nil
+}
+
+// Finish sends the buffered body to the wrapped ResponseWriter, applying
+// t.Compression if it's CompressionAuto, then returns the buffer to the
+// pool. status of 0 means "don't call WriteHeader" -- leave whatever status
+// the caller already staged on the wrapped ResponseWriter (as Gin does) to
+// take effect on the first Write, which defaults to 200 if nothing staged
+// one. r is used for conditional-GET and Accept-Encoding negotiation when
+// Compression is enabled; it may be nil if unavailable.
+func (b *BufferedResponseWriter) Finish(t *Templates, r *http.Request, status int) error {
+	defer b.Release()
+	if t.Compression == CompressionAuto {
+		return t.compressAndWrite(b.ResponseWriter, r, status, b.buf.Bytes())
+	}
+	b.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(b.buf.Len()))
+	if status != 0 {
+		b.ResponseWriter.WriteHeader(status)
+	}
+	_, err := b.ResponseWriter.Write(b.buf.Bytes())
+	return err
+}
+
+// ifNoneMatchSatisfied reports whether etag appears among the comma-separated
+// entity tags in an If-None-Match header (a bare "*" always matches).
+func ifNoneMatchSatisfied(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks the best encoding this binary can produce that r
+// accepts via its Accept-Encoding header, preferring br over gzip. It
+// returns "" and a nil encode func if r is nil or accepts neither.
+func negotiateEncoding(r *http.Request) (string, func([]byte) ([]byte, error)) {
+	if r == nil {
+		return "", nil
+	}
+	accept := r.Header.Get("Accept-Encoding")
+	if accept == "" {
+		return "", nil
+	}
+	if brotliEncode != nil && strings.Contains(accept, "br") {
+		return "br", brotliEncode
+	}
+	if strings.Contains(accept, "gzip") {
+		return "gzip", gzipEncode
+	}
+	return "", nil
+}
+
+func gzipEncode(body []byte) ([]byte, error) {
+	gw := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(gw)
+
+	var buf bytes.Buffer
+	gw.Reset(&buf)
+	if _, err := gw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
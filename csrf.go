@@ -0,0 +1,96 @@
+package templates
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/google/safehtml/uncheckedconversions"
+)
+
+const csrfSessionKey = "_csrf_token"
+
+// CSRFContextKey holds the current request's CSRF token, set by
+// CSRF.Middleware and read back by the csrf_token/csrf_field template
+// functions EnableCSRF registers.
+type CSRFContextKey struct{}
+
+// CSRF holds the configuration EnableCSRF installs.
+type CSRF struct {
+	// Store persists the per-session token across requests.
+	Store SessionStore
+
+	// FormField is both the name Middleware reads the submitted token from
+	// on a state-changing request, and the name csrf_field's hidden input
+	// carries it under.
+	FormField string
+}
+
+// EnableCSRF registers {{csrf_token}} and {{csrf_field}} on t, backed by
+// store, and returns a *CSRF whose Middleware issues and validates the
+// token. formField names the form field (and hidden input) the token
+// travels in, e.g. "csrf_token":
+//
+//	csrf := tmpls.EnableCSRF(templates.CookieSessionStore{}, "csrf_token")
+//	router.Use(csrf.Middleware)
+func (t *Templates) EnableCSRF(store SessionStore, formField string) *CSRF {
+	c := &CSRF{Store: store, FormField: formField}
+	t.RegisterDynamicFunc("csrf_token", func(r *http.Request) any {
+		return c.tokenFromContext(r)
+	})
+	t.RegisterDynamicFunc("csrf_field", func(r *http.Request) any {
+		token := c.tokenFromContext(r)
+		html := fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, formField, token)
+		return uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract(html)
+	})
+	return c
+}
+
+func (c *CSRF) tokenFromContext(r *http.Request) string {
+	token, _ := r.Context().Value(CSRFContextKey{}).(string)
+	return token
+}
+
+// Middleware ensures every request carries a CSRF token -- issuing and
+// persisting a new one via Store on first visit -- makes it available to
+// csrf_token/csrf_field through the request's context, and rejects a
+// POST/PUT/PATCH/DELETE request whose FormField doesn't match it with 403
+// Forbidden. It is plain net/http middleware, so chi and chirender can use it
+// directly; see integrations/gin and integrations/echo for their adapters.
+func (c *CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := c.Store.Get(r, csrfSessionKey)
+		if !ok || token == "" {
+			token = newCSRFToken()
+			c.Store.Set(w, r, csrfSessionKey, token)
+		}
+		r = r.WithContext(context.WithValue(r.Context(), CSRFContextKey{}, token))
+
+		submitted := r.FormValue(c.FormField)
+		if isStateChangingMethod(r.Method) && subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isStateChangingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("templates: generating CSRF token: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,143 @@
+package templates
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/google/safehtml/template"
+)
+
+// dynamicFuncPatcher is implemented by ParsedTemplate values whose engine can
+// clone itself and merge additional functions into the clone's FuncMap in
+// place, e.g. *safehtmlParsedTemplate and *textParsedTemplate.
+// RegisterDynamicFunc's per-request resolution only applies to templates
+// parsed by an Engine that implements this; other engines keep calling the
+// placeholder func registered at parse time, which always resolves to nil.
+type dynamicFuncPatcher interface {
+	// Clone returns an independent copy of this template set that Funcs can
+	// be called on without affecting the original or any other clone.
+	Clone() (ParsedTemplate, error)
+
+	// Funcs merges fnMap into this template set's function map in place.
+	Funcs(fnMap map[string]any) error
+}
+
+// RegisterDynamicFunc makes name available to template actions (e.g.
+// `{{csrf_token}}`) as a function resolved fresh for every request from
+// factory, instead of a value baked into the template at parse time. This
+// replaces the old pattern of cloning the whole parsed template and
+// re-attaching a FuncMap per request -- expensive at scale, since Clone deep
+// copies the entire parse tree -- with a small pool of pre-cloned template
+// sets (see executeDynamic) that only have their FuncMap patched, a cheap map
+// merge, right before each execution. Hugo measured ~10% slower and ~15% more
+// allocations doing the per-request full clone this avoids.
+//
+// factory receives the current *http.Request and returns the value name
+// should evaluate to for it:
+//
+//	tmpls.RegisterDynamicFunc("csrf_token", func(r *http.Request) any {
+//		return csrf.Token(r)
+//	})
+//
+// Call it before ParseTemplates (typically right after New): it registers a
+// placeholder func under name so that parsing `{{csrf_token}}` succeeds. The
+// placeholder is variadic, matching Locals/References, so the action parses
+// with no arguments. executeDynamic swaps in the real value via factory
+// before every execution it runs; anywhere the placeholder itself is still
+// called (see dynamicFuncPatcher), it returns nil.
+func (t *Templates) RegisterDynamicFunc(name string, factory func(*http.Request) any) {
+	if t.dynamicFuncs == nil {
+		t.dynamicFuncs = map[string]func(*http.Request) any{}
+	}
+	t.dynamicFuncs[name] = factory
+
+	if t.funcMap == nil {
+		t.funcMap = template.FuncMap{}
+	}
+	if _, ok := t.funcMap[name]; !ok {
+		t.funcMap[name] = func(...any) any { return nil }
+	}
+}
+
+// RegisterDynamicArgFunc is RegisterDynamicFunc for a function whose result
+// depends on the arguments the template action passes it, not just on the
+// current request -- e.g. `{{flash "success"}}` needing to know which flash
+// category "success" names. Unlike RegisterDynamicFunc's factory, which runs
+// once per execution regardless of how name is called, factory here runs
+// once per call, receiving that call's own arguments alongside r.
+func (t *Templates) RegisterDynamicArgFunc(name string, factory func(r *http.Request, args ...any) any) {
+	if t.dynamicArgFuncs == nil {
+		t.dynamicArgFuncs = map[string]func(r *http.Request, args ...any) any{}
+	}
+	t.dynamicArgFuncs[name] = factory
+
+	if t.funcMap == nil {
+		t.funcMap = template.FuncMap{}
+	}
+	if _, ok := t.funcMap[name]; !ok {
+		t.funcMap[name] = func(...any) any { return nil }
+	}
+}
+
+// executeDynamic executes tmpl, resolving every name registered via
+// RegisterDynamicFunc/RegisterDynamicArgFunc against r and patching them
+// into a pooled clone of tmpl before execution, instead of executing tmpl
+// directly. Templates with no such registrations pay nothing extra: it falls
+// straight through to tmpl.ExecuteTemplate.
+func (t *Templates) executeDynamic(tmpl ParsedTemplate, w io.Writer, r *http.Request, name string, data any) error {
+	if len(t.dynamicFuncs) == 0 && len(t.dynamicArgFuncs) == 0 {
+		return tmpl.ExecuteTemplate(w, name, data)
+	}
+	patcher, ok := tmpl.(dynamicFuncPatcher)
+	if !ok {
+		return tmpl.ExecuteTemplate(w, name, data)
+	}
+
+	pool := t.dynamicPoolFor(patcher)
+	clone := pool.Get().(dynamicFuncPatcher)
+	defer pool.Put(clone)
+
+	resolved := make(map[string]any, len(t.dynamicFuncs)+len(t.dynamicArgFuncs))
+	for fnName, factory := range t.dynamicFuncs {
+		value := factory(r)
+		resolved[fnName] = func(...any) any { return value }
+	}
+	for fnName, factory := range t.dynamicArgFuncs {
+		factory := factory
+		resolved[fnName] = func(args ...any) any { return factory(r, args...) }
+	}
+	if err := clone.Funcs(resolved); err != nil {
+		return err
+	}
+	return clone.(ParsedTemplate).ExecuteTemplate(w, name, data)
+}
+
+// dynamicPoolFor returns the sync.Pool of clones for base, creating it (and
+// one clone to seed it) on first use. Clones are keyed by the ParsedTemplate
+// instance itself so every parsed layout/page/block combination, for every
+// registered output format, gets its own pool.
+func (t *Templates) dynamicPoolFor(base dynamicFuncPatcher) *sync.Pool {
+	t.dynamicPoolsLock.Lock()
+	defer t.dynamicPoolsLock.Unlock()
+	if t.dynamicPools == nil {
+		t.dynamicPools = map[ParsedTemplate]*sync.Pool{}
+	}
+	if pool, ok := t.dynamicPools[base.(ParsedTemplate)]; ok {
+		return pool
+	}
+	pool := &sync.Pool{New: func() any {
+		clone, err := base.Clone()
+		if err != nil {
+			// Cloning can only fail if the underlying template library's
+			// own Clone does, which ParseFiles would already have hit
+			// parsing the original; fall back to patching base directly --
+			// unsafe under concurrent requests, but better than dropping
+			// the dynamic value entirely.
+			return base
+		}
+		return clone
+	}}
+	t.dynamicPools[base.(ParsedTemplate)] = pool
+	return pool
+}
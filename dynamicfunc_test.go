@@ -0,0 +1,113 @@
+package templates
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func newDynamicFuncFixture(t testing.TB) *Templates {
+	tmpDir, err := ioutil.TempDir("", "dynamic_func")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	layoutsDir := filepath.Join(tmpDir, "layouts")
+	pagesDir := filepath.Join(tmpDir, "pages")
+	os.MkdirAll(layoutsDir, 0755)
+	os.MkdirAll(pagesDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutsDir, "custom.gohtml"), []byte(`{{define "layout"}}{{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "greet.gohtml"), []byte(`{{define "page"}}{{csrf_token}} says hi to {{current_user}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	return tmpls
+}
+
+func Test_RegisterDynamicFunc(t *testing.T) {
+	tmpls := newDynamicFuncFixture(t)
+
+	var nextToken int64
+	tmpls.RegisterDynamicFunc("csrf_token", func(r *http.Request) any {
+		return "token-" + strconv.FormatInt(atomic.AddInt64(&nextToken, 1), 10)
+	})
+	tmpls.RegisterDynamicFunc("current_user", func(r *http.Request) any {
+		return r.Header.Get("X-User")
+	})
+	tmpls.MustParseTemplates()
+
+	r1 := httptest.NewRequest("GET", "/", nil)
+	r1.Header.Set("X-User", "alice")
+	res1, err := tmpls.ExecuteTemplateAsText(r1, "custom:greet", nil)
+	failOnErr(t, err)
+	if want := "token-1 says hi to alice"; res1 != want {
+		t.Errorf("expected %q, got %q", want, res1)
+	}
+
+	r2 := httptest.NewRequest("GET", "/", nil)
+	r2.Header.Set("X-User", "bob")
+	res2, err := tmpls.ExecuteTemplateAsText(r2, "custom:greet", nil)
+	failOnErr(t, err)
+	if want := "token-2 says hi to bob"; res2 != want {
+		t.Errorf("expected %q, got %q", want, res2)
+	}
+}
+
+func Test_RegisterDynamicFunc_Concurrency(t *testing.T) {
+	tmpls := newDynamicFuncFixture(t)
+	tmpls.RegisterDynamicFunc("csrf_token", func(r *http.Request) any { return "tok" })
+	tmpls.RegisterDynamicFunc("current_user", func(r *http.Request) any { return r.Header.Get("X-User") })
+	tmpls.MustParseTemplates()
+
+	const n = 50
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("X-User", strconv.Itoa(i))
+			res, err := tmpls.ExecuteTemplateAsText(r, "custom:greet", nil)
+			if err == nil {
+				if want := "tok says hi to " + strconv.Itoa(i); res != want {
+					err = fmt.Errorf("expected %q, got %q", want, res)
+				}
+			}
+			errs <- err
+		}(i)
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// BenchmarkExecuteTemplate_DynamicFuncs measures rendering a page with two
+// request-scoped funcs resolved via the RegisterDynamicFunc pool, simulating
+// N concurrent requests each needing a couple of request-scoped values.
+func BenchmarkExecuteTemplate_DynamicFuncs(b *testing.B) {
+	tmpls := newDynamicFuncFixture(b)
+	tmpls.RegisterDynamicFunc("csrf_token", func(r *http.Request) any { return "tok" })
+	tmpls.RegisterDynamicFunc("current_user", func(r *http.Request) any { return "user" })
+	tmpls.MustParseTemplates()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := tmpls.ExecuteTemplateAsText(r, "custom:greet", nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
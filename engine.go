@@ -0,0 +1,40 @@
+package templates
+
+import "io"
+
+// Engine abstracts the underlying template library used to parse and execute
+// a set of template files. Templates defaults to SafehtmlEngine (backed by
+// google/safehtml/template), but an alternative syntax -- Handlebars,
+// Pongo2, text/template for non-HTML output, etc. -- can be plugged in via
+// the Engine field on Templates. Layout resolution, LayoutContextKey
+// switching, output-format selection and every framework integration only
+// ever talk to the Templates facade, so they keep working unchanged
+// regardless of which Engine is configured.
+//
+// Multiple engines can coexist in one project: Templates.TemplateFileExtensions
+// maps a file extension to an EngineKind, and Templates.Engines maps that
+// EngineKind to the Engine instance parsing it (EngineSafehtml always uses
+// Engine above instead). See integrations/handlebars for an Engine that
+// registers its own EngineKind this way, or Test_CustomEngine_ReplacesDefault
+// for the minimal case of swapping Engine itself for something that isn't
+// html/template at all.
+type Engine interface {
+	// ParseFiles parses files as one named template set (e.g. a
+	// layout+page+blocks combination, or a single block file) using fnMap
+	// for the functions available to template actions.
+	ParseFiles(fnMap map[string]any, files ...string) (ParsedTemplate, error)
+}
+
+// ParsedTemplate is one engine-parsed template set, as returned by
+// Engine.ParseFiles.
+type ParsedTemplate interface {
+	// ExecuteTemplate executes the named template defined within this set
+	// (e.g. "layout", "page", a block name, or a name passed to RenderFragment).
+	ExecuteTemplate(w io.Writer, name string, data any) error
+
+	// DefinedTemplates returns the names of every template defined within
+	// this set that has a body (i.e. would render something if executed).
+	// Used to validate that a block file actually defines the block name its
+	// filename implies.
+	DefinedTemplates() []string
+}
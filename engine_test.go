@@ -0,0 +1,125 @@
+package templates
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// upperEngine is a minimal templates.Engine that ignores Go template syntax
+// entirely -- it just upper-cases the file's raw content -- to prove
+// Templates.Engine genuinely decouples ExecuteTemplate/RenderBlockAsHTMLString
+// etc. from html/template, not just from safehtml specifically. See
+// integrations/handlebars for a real third-party example of the same seam.
+type upperEngine struct {
+	files map[string]string // relative path -> raw content, keyed the same way the OS filesystem would be
+}
+
+func (e upperEngine) ParseFiles(fnMap map[string]any, files ...string) (ParsedTemplate, error) {
+	p := &upperParsedTemplate{named: map[string]string{}}
+	for _, file := range files {
+		src, ok := e.files[file]
+		if !ok {
+			return nil, fmt.Errorf("upperEngine: no such file %s", file)
+		}
+		p.named[roleOfUpper(file)] = strings.ToUpper(src)
+	}
+	return p, nil
+}
+
+func roleOfUpper(file string) string {
+	switch filepath.Base(filepath.Dir(file)) {
+	case "layouts":
+		return "layout"
+	case "pages":
+		return "page"
+	default:
+		base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if !strings.HasPrefix(base, "_") {
+			base = "_" + base
+		}
+		return base
+	}
+}
+
+type upperParsedTemplate struct {
+	named map[string]string
+}
+
+func (p *upperParsedTemplate) ExecuteTemplate(w io.Writer, name string, data any) error {
+	body, ok := p.named[name]
+	if !ok {
+		return fmt.Errorf("upperEngine: template %q not found", name)
+	}
+	_, err := io.WriteString(w, body)
+	return err
+}
+
+func (p *upperParsedTemplate) DefinedTemplates() []string {
+	names := make([]string, 0, len(p.named))
+	for name := range p.named {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Test_CustomEngine_ReplacesDefault swaps Templates.Engine for a stand-in
+// that doesn't use html/template at all, and checks that ParseTemplates,
+// ExecuteTemplateAsText and RenderBlockAsHTMLString still work unchanged --
+// the same seam integrations/handlebars plugs a real third-party engine
+// into, here exercised directly without a dependency.
+func Test_CustomEngine_ReplacesDefault(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "custom_engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layoutsDir := filepath.Join(tmpDir, "layouts")
+	pagesDir := filepath.Join(tmpDir, "pages")
+	blocksDir := filepath.Join(tmpDir, "blocks")
+	os.MkdirAll(layoutsDir, 0755)
+	os.MkdirAll(pagesDir, 0755)
+	os.MkdirAll(blocksDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutsDir, "application.gohtml"), []byte("layout"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "hello.gohtml"), []byte("hello page"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(blocksDir, "footer.gohtml"), []byte("footer block"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// ParseFiles receives paths relative to tmpDir (the root Templates was
+	// built from via NewWithRoot), not absolute ones -- see
+	// Templates.getFilePathsInDir.
+	engineFiles := map[string]string{
+		filepath.Join("layouts", "application.gohtml"): "layout",
+		filepath.Join("pages", "hello.gohtml"):          "hello page",
+		filepath.Join("blocks", "footer.gohtml"):        "footer block",
+	}
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.Engine = upperEngine{files: engineFiles}
+	tmpls.MustParseTemplates()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	res, err := tmpls.ExecuteTemplateAsText(r, ":hello", nil)
+	failOnErr(t, err)
+	if want := "HELLO PAGE"; res != want {
+		t.Errorf("expected the custom engine's upper-cased page, got %q", res)
+	}
+
+	block, err := tmpls.RenderBlockAsHTMLString("_footer", nil)
+	failOnErr(t, err)
+	if want := "FOOTER BLOCK"; block.String() != want {
+		t.Errorf("expected the custom engine's upper-cased block, got %q", block.String())
+	}
+}
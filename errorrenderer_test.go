@@ -0,0 +1,118 @@
+package templates
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_RenderErrorWithData(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "error_renderer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layoutsDir := filepath.Join(tmpDir, "layouts")
+	pagesDir := filepath.Join(tmpDir, "pages")
+	os.MkdirAll(layoutsDir, 0755)
+	os.MkdirAll(pagesDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutsDir, "application.gohtml"), []byte(`{{define "layout"}}{{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "error.gohtml"), []byte(`{{define "page"}}{{.Status}}: {{.Message}} trace={{.TraceID}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	tmpls.RenderErrorWithData(rec, req, 500, errors.New("boom"), map[string]any{"TraceID": "abc123"})
+
+	if rec.Code != 500 {
+		t.Errorf("expected status 500, got %d", rec.Code)
+	}
+	if want := "500: boom trace=abc123"; rec.Body.String() != want {
+		t.Errorf("expected %q, got %q", want, rec.Body.String())
+	}
+}
+
+func Test_ErrorTemplateResolver(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "error_resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layoutsDir := filepath.Join(tmpDir, "layouts")
+	pagesDir := filepath.Join(tmpDir, "pages")
+	os.MkdirAll(layoutsDir, 0755)
+	os.MkdirAll(pagesDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutsDir, "application.gohtml"), []byte(`{{define "layout"}}{{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "errors_not_found.gohtml"), []byte(`{{define "page"}}custom 404{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.ErrorTemplateResolver = func(status int) []string {
+		if status == 404 {
+			return []string{"errors_not_found"}
+		}
+		return []string{"error"}
+	}
+	tmpls.MustParseTemplates()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	tmpls.RenderError(rec, req, 404, nil)
+
+	if rec.Code != 404 {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+	if want := "custom 404"; rec.Body.String() != want {
+		t.Errorf("expected %q, got %q", want, rec.Body.String())
+	}
+}
+
+func Test_MustHaveErrorTemplates(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "error_musthave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layoutsDir := filepath.Join(tmpDir, "layouts")
+	pagesDir := filepath.Join(tmpDir, "pages")
+	os.MkdirAll(layoutsDir, 0755)
+	os.MkdirAll(pagesDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutsDir, "application.gohtml"), []byte(`{{define "layout"}}{{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "error.gohtml"), []byte(`{{define "page"}}generic error{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+
+	// 500 resolves to the generic "error" page, so this must not panic.
+	tmpls.MustHaveErrorTemplates(500)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected MustHaveErrorTemplates to panic for a status with no resolvable template")
+		}
+	}()
+	tmpls.ErrorTemplateResolver = func(status int) []string { return []string{"no_such_template"} }
+	tmpls.MustHaveErrorTemplates(404)
+}
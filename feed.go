@@ -0,0 +1,129 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// FeedEntry is one item in an Atom feed or sitemap, e.g. one row of the
+// []Page slice a blog's listing handler already builds for its "posts" page.
+type FeedEntry struct {
+	Title   string
+	URL     string
+	Updated time.Time
+	Summary string
+}
+
+// Feed is the data passed to the Atom/sitemap templates: a title and ID for
+// the feed itself, plus the entries to list.
+type Feed struct {
+	// Title is the feed's human-readable title.
+	Title string
+
+	// ID is the feed's own canonical URL, used as the Atom <id> and
+	// <link rel="self">.
+	ID string
+
+	// Updated is the feed's last-modified time, e.g. the newest Entry's
+	// Updated.
+	Updated time.Time
+
+	Entries []FeedEntry
+}
+
+const defaultAtomTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>{{.Title | xmlesc}}</title>
+  <id>{{.ID | xmlesc}}</id>
+  <link rel="self" href="{{.ID | xmlesc}}"/>
+  <updated>{{.Updated.Format "2006-01-02T15:04:05Z07:00"}}</updated>
+  {{range .Entries}}<entry>
+    <title>{{.Title | xmlesc}}</title>
+    <id>{{.URL | xmlesc}}</id>
+    <link href="{{.URL | xmlesc}}"/>
+    <updated>{{.Updated.Format "2006-01-02T15:04:05Z07:00"}}</updated>
+    <summary>{{.Summary | xmlesc}}</summary>
+  </entry>
+  {{end}}</feed>
+`
+
+const defaultSitemapTemplate = `<?xml version="1.0" encoding="utf-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  {{range .Entries}}<url>
+    <loc>{{.URL | xmlesc}}</loc>
+    <lastmod>{{.Updated.Format "2006-01-02"}}</lastmod>
+  </url>
+  {{end}}</urlset>
+`
+
+// xmlFuncs is the FuncMap the built-in Atom/sitemap templates use to escape
+// entry fields, since text/template -- unlike html/template -- does no
+// escaping of its own and these fields are attacker-controlled (post titles,
+// URLs) ending up inside an XML document.
+var xmlFuncs = template.FuncMap{"xmlesc": xmlesc}
+
+// xmlesc escapes s for safe inclusion in XML character data, the same
+// guarantee html/template gives HTML pages elsewhere in this module.
+func xmlesc(s string) string {
+	var buf bytes.Buffer
+	if err := xml.EscapeText(&buf, []byte(s)); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
+var (
+	defaultAtomOnce    sync.Once
+	defaultAtomParsed  *template.Template
+	defaultSitemapOnce sync.Once
+	defaultSitemapDoc  *template.Template
+)
+
+func defaultAtom() *template.Template {
+	defaultAtomOnce.Do(func() {
+		defaultAtomParsed = template.Must(template.New("atom").Funcs(xmlFuncs).Parse(defaultAtomTemplate))
+	})
+	return defaultAtomParsed
+}
+
+func defaultSitemap() *template.Template {
+	defaultSitemapOnce.Do(func() {
+		defaultSitemapDoc = template.Must(template.New("sitemap").Funcs(xmlFuncs).Parse(defaultSitemapTemplate))
+	})
+	return defaultSitemapDoc
+}
+
+// RenderAtomFeed writes feed as an Atom XML document to w, setting
+// Content-Type to application/atom+xml if w is an http.ResponseWriter and it
+// isn't already set. It renders the "atom" page (under any layout, via
+// ExecuteTemplate) when one was parsed, so an app can fully customize the
+// markup, and falls back to a minimal built-in template otherwise.
+func (t *Templates) RenderAtomFeed(w io.Writer, r *http.Request, feed Feed) error {
+	if rw, ok := w.(http.ResponseWriter); ok && rw.Header().Get("Content-Type") == "" {
+		rw.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	}
+	if t.pageExists("atom") {
+		return t.ExecuteTemplate(w, r, "atom", feed)
+	}
+	return defaultAtom().Execute(w, feed)
+}
+
+// RenderSitemap writes feed as a sitemap.xml document to w, setting
+// Content-Type to application/xml if w is an http.ResponseWriter and it
+// isn't already set. It renders the "sitemap" page when one was parsed, and
+// falls back to a minimal built-in template otherwise. Only FeedEntry.URL
+// and FeedEntry.Updated are used.
+func (t *Templates) RenderSitemap(w io.Writer, r *http.Request, feed Feed) error {
+	if rw, ok := w.(http.ResponseWriter); ok && rw.Header().Get("Content-Type") == "" {
+		rw.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	if t.pageExists("sitemap") {
+		return t.ExecuteTemplate(w, r, "sitemap", feed)
+	}
+	return defaultSitemap().Execute(w, feed)
+}
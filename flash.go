@@ -0,0 +1,62 @@
+package templates
+
+import (
+	"context"
+	"net/http"
+)
+
+// FlashContextKey holds the flash messages FlashMiddleware popped for the
+// current request, keyed by category, for the flash template function
+// EnableFlash registers to read back.
+type FlashContextKey struct{}
+
+// SetFlash stores message under category in store for the next request to
+// read once, e.g. right before an http.Redirect following a form
+// submission:
+//
+//	templates.SetFlash(w, r, store, "success", "Saved.")
+func SetFlash(w http.ResponseWriter, r *http.Request, store SessionStore, category, message string) {
+	store.Set(w, r, flashSessionKey(category), message)
+}
+
+func flashSessionKey(category string) string {
+	return "_flash_" + category
+}
+
+// FlashMiddleware pops every pending flash message this request's session
+// carries, for each of categories, out of store and stashes them in the
+// request's context under FlashContextKey, clearing each one from store so
+// it's only ever read once. categories must be declared up front since a
+// session store has no way to enumerate its own keys.
+func FlashMiddleware(store SessionStore, categories ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			messages := map[string]string{}
+			for _, category := range categories {
+				key := flashSessionKey(category)
+				if msg, ok := store.Get(r, key); ok && msg != "" {
+					messages[category] = msg
+					store.Delete(w, r, key)
+				}
+			}
+			ctx := context.WithValue(r.Context(), FlashContextKey{}, messages)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// EnableFlash registers {{flash "category"}} via RegisterDynamicArgFunc,
+// returning whatever message FlashMiddleware popped for that category on
+// this request, or "" if there was none. It requires FlashMiddleware
+// somewhere in the handler chain -- without it, {{flash "category"}} always
+// returns "".
+func (t *Templates) EnableFlash() {
+	t.RegisterDynamicArgFunc("flash", func(r *http.Request, args ...any) any {
+		if len(args) != 1 {
+			return ""
+		}
+		category, _ := args[0].(string)
+		messages, _ := r.Context().Value(FlashContextKey{}).(map[string]string)
+		return messages[category]
+	})
+}
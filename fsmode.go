@@ -0,0 +1,21 @@
+package templates
+
+import (
+	"embed"
+
+	"github.com/google/safehtml/template"
+)
+
+// NewFromBuildMode is New, with the dev-vs-prod filesystem switch every
+// example app otherwise hand-writes as its own "useEmbeddedFS" const and
+// if/else: build with the "dev" tag (`go run -tags dev ./...`) to serve
+// templates straight from the OS filesystem with AlwaysReloadAndParseTemplates
+// on, or without it to serve embedded from a single self-contained binary.
+// See DevMode and DefaultFS.
+func NewFromBuildMode(embedded *embed.FS, funcs template.FuncMap) *Templates {
+	t := New(DefaultFS(embedded), funcs)
+	if DevMode() {
+		t.AlwaysReloadAndParseTemplates = true
+	}
+	return t
+}
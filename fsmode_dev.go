@@ -0,0 +1,22 @@
+//go:build dev
+
+package templates
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// DevMode reports whether this binary was built with the "dev" build tag.
+func DevMode() bool {
+	return true
+}
+
+// DefaultFS returns the filesystem NewFromBuildMode should parse templates
+// from for this build: dev builds always read straight from the OS
+// filesystem (so AlwaysReloadAndParseTemplates/WatchAndReload can pick up
+// edits without a rebuild), so embedded is ignored and nil is returned --
+// the same value New already treats as "use os.DirFS(templatesPath)".
+func DefaultFS(embedded *embed.FS) fs.FS {
+	return nil
+}
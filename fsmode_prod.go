@@ -0,0 +1,21 @@
+//go:build !dev
+
+package templates
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// DevMode reports whether this binary was built with the "dev" build tag.
+func DevMode() bool {
+	return false
+}
+
+// DefaultFS returns the filesystem NewFromBuildMode should parse templates
+// from for this build: a non-dev build serves a single self-contained
+// binary, so it returns embedded itself (the value New's *embed.FS case
+// expects).
+func DefaultFS(embedded *embed.FS) fs.FS {
+	return embedded
+}
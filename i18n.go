@@ -0,0 +1,99 @@
+package templates
+
+import "net/http"
+
+// Translator resolves a message key to localized text for T, selecting a
+// plural form based on count when the underlying catalog has more than one
+// for that key.
+type Translator interface {
+	// Translate returns the text for key in locale, given count (for
+	// pluralization). ok is false if key has no entry for locale at all.
+	Translate(locale, key string, count int) (text string, ok bool)
+}
+
+// MapCatalog is a minimal Translator backed by a nested map: locale -> key
+// -> plural form -> text. The only plural forms Translate looks for are
+// "one" (used when count == 1, if present) and "other" (the fallback for
+// every other count, and for a key with just one form). The text is
+// returned exactly as stored; nothing in it is substituted.
+//
+//	templates.MapCatalog{
+//		"en": {"item_count": {"one": "1 item", "other": "many items"}},
+//	}
+type MapCatalog map[string]map[string]map[string]string
+
+// Translate implements Translator.
+func (c MapCatalog) Translate(locale, key string, count int) (string, bool) {
+	messages, ok := c[locale]
+	if !ok {
+		return "", false
+	}
+	forms, ok := messages[key]
+	if !ok {
+		return "", false
+	}
+	if count == 1 {
+		if text, ok := forms["one"]; ok {
+			return text, true
+		}
+	}
+	text, ok := forms["other"]
+	return text, ok
+}
+
+// LocaleContextKey holds the current request's resolved locale (e.g. "en",
+// "de-DE") for T to read back. Nothing in this package sets it -- an app
+// middleware resolving a locale from Accept-Language, a path prefix or a
+// cookie should store it here before rendering.
+type LocaleContextKey struct{}
+
+// AddI18nFuncMapHelpers registers "T" against catalog via
+// RegisterDynamicArgFunc, resolving the request's locale from
+// LocaleContextKey (falling back to defaultLocale if the context carries
+// none, or there's no request at all):
+//
+//	{{ T "greeting" }}
+//	{{ T "item_count" .Count }}
+//
+// A key with no match in catalog for the resolved locale renders as
+// "[key]" rather than failing the whole page, so a missing translation is
+// visible in a rendered page instead of 500ing it.
+func (t *Templates) AddI18nFuncMapHelpers(catalog Translator, defaultLocale string) {
+	t.RegisterDynamicArgFunc("T", func(r *http.Request, args ...any) any {
+		if len(args) == 0 {
+			return ""
+		}
+		key, _ := args[0].(string)
+		count := 1
+		if len(args) > 1 {
+			if n, ok := toInt(args[1]); ok {
+				count = n
+			}
+		}
+		locale := defaultLocale
+		if r != nil {
+			if l, ok := r.Context().Value(LocaleContextKey{}).(string); ok && l != "" {
+				locale = l
+			}
+		}
+		if text, ok := catalog.Translate(locale, key, count); ok {
+			return text
+		}
+		return "[" + key + "]"
+	})
+}
+
+// toInt converts the handful of numeric types a template action might pass
+// for a pluralization count into an int.
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	default:
+		return 0, false
+	}
+}
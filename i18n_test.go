@@ -0,0 +1,68 @@
+// ==== File: i18n_test.go ====
+package templates
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_AddI18nFuncMapHelpers(t *testing.T) {
+	catalog := MapCatalog{
+		"en": {
+			"greeting":   {"other": "Hello"},
+			"item_count": {"one": "1 item", "other": "items"},
+		},
+		"de": {
+			"greeting": {"other": "Hallo"},
+		},
+	}
+
+	tmpls := New(nil, nil)
+	tmpls.AddI18nFuncMapHelpers(catalog, "en")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	resolve := func(r *http.Request, args ...any) any {
+		return tmpls.dynamicArgFuncs["T"](r, args...)
+	}
+
+	if got := resolve(req, "greeting"); got != "Hello" {
+		t.Errorf("expected default-locale lookup to return %q, got %q", "Hello", got)
+	}
+
+	deReq := req.WithContext(context.WithValue(req.Context(), LocaleContextKey{}, "de"))
+	if got := resolve(deReq, "greeting"); got != "Hallo" {
+		t.Errorf("expected locale-aware lookup to return %q, got %q", "Hallo", got)
+	}
+
+	if got := resolve(req, "item_count", 1); got != "1 item" {
+		t.Errorf("expected singular pluralization, got %q", got)
+	}
+	if got := resolve(req, "item_count", 3); got != "items" {
+		t.Errorf("expected plural fallback, got %q", got)
+	}
+
+	if got := resolve(req, "missing"); got != "[missing]" {
+		t.Errorf("expected a missing key to render as [missing], got %q", got)
+	}
+}
+
+type stubCMSField struct {
+	kind, value string
+}
+
+func (f stubCMSField) TrustedKind() string { return f.kind }
+func (f stubCMSField) Value() string       { return f.value }
+
+func Test_AddAutoTrustedFuncMapHelper(t *testing.T) {
+	tmpls := New(nil, nil)
+	tmpls.AddAutoTrustedFuncMapHelper()
+
+	if got := autoTrusted(stubCMSField{"html", "<b>hi</b>"}).(interface{ String() string }).String(); got != "<b>hi</b>" {
+		t.Errorf("expected trusted HTML passthrough, got %q", got)
+	}
+	if got := autoTrusted(stubCMSField{"unknown", "plain"}); got != "plain" {
+		t.Errorf("expected an unrecognized kind to fall back to the raw value, got %v", got)
+	}
+}
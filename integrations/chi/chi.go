@@ -27,8 +27,11 @@ func FromTemplates(t *templates.Templates) *Renderer {
 	return &Renderer{t}
 }
 
-// Render executes a template, sets the HTTP status code, and writes the output
-// to the http.ResponseWriter.
+// Render executes a template into a pooled buffer and, once that succeeds,
+// writes the status code and output to the http.ResponseWriter. Buffering
+// first means a template execution error never leaves a partial response on
+// the wire, and lets templates.Templates.Compression apply an ETag and
+// negotiate Accept-Encoding over the complete body.
 //
 // Parameters:
 //   - w: The http.ResponseWriter to write the rendered output to.
@@ -37,8 +40,25 @@ func FromTemplates(t *templates.Templates) *Renderer {
 //   - name: The template name to render, using the "layout:page" or ":page" syntax.
 //   - data: The data to pass to the template.
 func (r *Renderer) Render(w http.ResponseWriter, req *http.Request, status int, name string, data interface{}) error {
-	w.WriteHeader(status)
-	return r.ExecuteTemplate(w, req, name, data)
+	bw := r.NewBufferedResponseWriter(w)
+	if err := r.ExecuteTemplate(bw, req, name, data); err != nil {
+		bw.Release()
+		return err
+	}
+	return bw.Finish(r.Templates, req, status)
+}
+
+// RenderFormat is Render, but forces templates.Templates.OutputFormats[format]
+// instead of negotiating one from the request. Use it for a route that
+// always serves one format, e.g. a feed route that should render "rss" even
+// for a client that sends no Accept header or URL suffix.
+func (r *Renderer) RenderFormat(w http.ResponseWriter, req *http.Request, status int, name, format string, data interface{}) error {
+	bw := r.NewBufferedResponseWriter(w)
+	if err := r.ExecuteFormat(bw, req, name, format, data); err != nil {
+		bw.Release()
+		return err
+	}
+	return bw.Finish(r.Templates, req, status)
 }
 
 // Handler returns a http.HandlerFunc that renders the given template with the provided data.
@@ -55,3 +75,59 @@ func (r *Renderer) Handler(templateName string, data interface{}) http.HandlerFu
 func (r *Renderer) HandlerWithDataFromContext(templateName string, contextKey interface{}) http.HandlerFunc {
 	return r.HandlerRenderWithDataFromContext(templateName, contextKey)
 }
+
+// RenderFragment executes a single `{{define "block"}}...{{end}}` from the
+// named template into a pooled buffer and, once that succeeds, sets the HTTP
+// status code and writes it to w, suitable for an htmx/Unpoly partial update
+// handler.
+func (r *Renderer) RenderFragment(w http.ResponseWriter, req *http.Request, status int, name, block string, data interface{}) error {
+	return r.Templates.RenderFragmentWithStatus(w, req, status, name, block, data)
+}
+
+// RenderFragments executes several blocks from the named template and
+// writes them to w, concatenated as plain HTML or, for a
+// text/vnd.turbo-stream.html Accept header, as Turbo Stream elements. See
+// templates.Templates.RenderFragments.
+func (r *Renderer) RenderFragments(w http.ResponseWriter, req *http.Request, name string, blocks []string, data interface{}) error {
+	return r.Templates.RenderFragments(w, req, name, blocks, data)
+}
+
+// ErrorHandler returns an http.Handler that renders a themed error page for
+// status via templates.Templates.RenderError. It can be assigned directly to
+// chi's router.NotFoundHandler/MethodNotAllowedHandler, e.g.
+// `router.NotFoundHandler(renderer.ErrorHandler(http.StatusNotFound, nil))`.
+func (r *Renderer) ErrorHandler(status int, err error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.RenderError(w, req, status, err)
+	})
+}
+
+// Recoverer returns a go-chi/middleware.Recoverer-compatible replacement:
+// panics are rendered as a themed error page via t.Recoverer instead of
+// chi's default plain-text panic dump.
+//
+//	router.Use(templates_chi.Recoverer(tmpls))
+func Recoverer(t *templates.Templates) func(http.Handler) http.Handler {
+	return t.Recoverer
+}
+
+// CSRF returns c.Middleware, under a name discoverable alongside this
+// package's other chi middleware.
+//
+//	csrf := tmpls.EnableCSRF(templates.CookieSessionStore{}, "csrf_token")
+//	router.Use(templates_chi.CSRF(csrf))
+func CSRF(c *templates.CSRF) func(http.Handler) http.Handler {
+	return c.Middleware
+}
+
+// MethodOverride returns templates.MethodOverride(formField), under a name
+// discoverable alongside this package's other chi middleware.
+func MethodOverride(formField string) func(http.Handler) http.Handler {
+	return templates.MethodOverride(formField)
+}
+
+// Flash returns templates.FlashMiddleware(store, categories...), under a
+// name discoverable alongside this package's other chi middleware.
+func Flash(store templates.SessionStore, categories ...string) func(http.Handler) http.Handler {
+	return templates.FlashMiddleware(store, categories...)
+}
@@ -1,6 +1,11 @@
 // ==== File: integrations/chirender/chirender.go ====
 // Package chirender provides an integration with the go-chi/render package,
 // allowing seamless rendering of HTML templates alongside JSON/XML APIs.
+//
+// Since go-chi/render sits on net/http, a chi router using this package can
+// recover panics into a themed error page with templates.Templates.Recoverer
+// directly, e.g. router.Use(tmpls.Recoverer), without a chirender-specific
+// wrapper.
 package chirender
 
 import (
@@ -16,17 +21,36 @@ type Template struct {
 	Templates *templates.Templates
 	Name      string
 	Data      interface{}
+
+	// Format, if set, forces templates.Templates.OutputFormats[Format]
+	// instead of negotiating one from the request via
+	// templates.Templates.ResolveOutputFormat. See NewFormat.
+	Format string
 }
 
-// Render satisfies the render.Renderer interface. It sets the Content-Type header
-// to "text/html" and executes the wrapped template. It also respects any status
-// code previously set on the request context via render.Status().
+// Render satisfies the render.Renderer interface. It renders the wrapped
+// template into a pooled buffer and only then writes the status code
+// (respecting any status previously set on the request context via
+// render.Status()) and body to w. Buffering first means a template
+// execution error never leaves a partial response on the wire, and lets
+// templates.Templates.Compression apply an ETag and negotiate
+// Accept-Encoding over the complete body.
 func (t *Template) Render(w http.ResponseWriter, r *http.Request) error {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if status, ok := r.Context().Value(render.StatusCtxKey).(int); ok {
-		w.WriteHeader(status)
+	status, _ := r.Context().Value(render.StatusCtxKey).(int)
+
+	bw := t.Templates.NewBufferedResponseWriter(w)
+	var err error
+	if t.Format != "" {
+		err = t.Templates.ExecuteFormat(bw, r, t.Name, t.Format, t.Data)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = t.Templates.ExecuteTemplate(bw, r, t.Name, t.Data)
 	}
-	return t.Templates.ExecuteTemplate(w, r, t.Name, t.Data)
+	if err != nil {
+		bw.Release()
+		return err
+	}
+	return bw.Finish(t.Templates, r, status)
 }
 
 // New returns a new Template instance that implements render.Renderer.
@@ -44,6 +68,19 @@ func New(tmpls *templates.Templates, name string, data interface{}) render.Rende
 	}
 }
 
+// NewFormat is New, but forces templates.Templates.OutputFormats[format]
+// instead of negotiating one from the request. Use it for a route that
+// always serves one format, e.g. a feed route that should render "rss" even
+// for a client that sends no Accept header or URL suffix.
+func NewFormat(tmpls *templates.Templates, name, format string, data interface{}) render.Renderer {
+	return &Template{
+		Templates: tmpls,
+		Name:      name,
+		Format:    format,
+		Data:      data,
+	}
+}
+
 // HTML is a custom responder for go-chi/render that handles the rendering of
 // HTML templates. If the payload `v` is a *chirender.Template, it executes
 // the template. Otherwise, it transparently falls back to the default
@@ -54,6 +91,11 @@ func New(tmpls *templates.Templates, name string, data interface{}) render.Rende
 //
 //	render.Respond = chirender.HTML
 func HTML(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if e, ok := v.(*ErrorPayload); ok {
+		e.Templates.RenderError(w, r, e.Status, e.Err)
+		return
+	}
+
 	t, ok := v.(*Template)
 	if !ok {
 		render.DefaultResponder(w, r, v)
@@ -61,9 +103,33 @@ func HTML(w http.ResponseWriter, r *http.Request, v interface{}) {
 	}
 
 	if err := t.Render(w, r); err != nil {
-		// The underlying templates engine logs the error, so we don't double-log.
-		// Attempt to send an error response. This might fail if the template
-		// has already started writing to the response writer.
+		// The underlying templates engine logs the error, so we don't
+		// double-log. Template.Render buffers into a pooled buffer and only
+		// writes to w on success, so this error response always reaches the
+		// client uncorrupted.
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
+
+// ErrorPayload wraps a status code and error so render.Respond renders a
+// themed error page for it via HTML, using templates.Templates.RenderError.
+type ErrorPayload struct {
+	Templates *templates.Templates
+	Status    int
+	Err       error
+}
+
+// Error returns a render.Renderer payload that, when passed to
+// render.Respond, renders a themed error page via templates.Templates.RenderError.
+//
+//	render.Respond(w, r, chirender.Error(tmpls, http.StatusNotFound, err))
+func Error(tmpls *templates.Templates, status int, err error) render.Renderer {
+	return &ErrorPayload{Templates: tmpls, Status: status, Err: err}
+}
+
+// Render satisfies the render.Renderer interface so ErrorPayload can also be
+// passed directly to render.Render/render.Respond without the HTML responder.
+func (e *ErrorPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	e.Templates.RenderError(w, r, e.Status, e.Err)
+	return nil
+}
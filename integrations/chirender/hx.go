@@ -0,0 +1,93 @@
+package chirender
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dryaf/templates"
+)
+
+// HXResponse is a fluent builder for an htmx/Hotwire-aware response: set
+// response headers (Push, Retarget, Reswap, Trigger), then call Render or
+// RenderBlocks to emit the page or fragment. See HX.
+type HXResponse struct {
+	tmpls *templates.Templates
+	w     http.ResponseWriter
+	r     *http.Request
+}
+
+// HX starts a fluent htmx/Hotwire response for w/r against tmpls:
+//
+//	chirender.HX(tmpls, w, r).Push("/users/5").Retarget("#flash").Render("users/show", user)
+func HX(tmpls *templates.Templates, w http.ResponseWriter, r *http.Request) *HXResponse {
+	return &HXResponse{tmpls: tmpls, w: w, r: r}
+}
+
+// Push sets HX-Push-Url, telling htmx to push url onto the browser history
+// instead of the request URL.
+func (h *HXResponse) Push(url string) *HXResponse {
+	h.w.Header().Set("HX-Push-Url", url)
+	return h
+}
+
+// Retarget sets HX-Retarget to a CSS selector, telling htmx to swap the
+// response into a different element than the one that made the request.
+func (h *HXResponse) Retarget(selector string) *HXResponse {
+	h.w.Header().Set("HX-Retarget", selector)
+	return h
+}
+
+// Reswap sets HX-Reswap, overriding htmx's swap strategy for this response
+// (e.g. "outerHTML", "beforeend").
+func (h *HXResponse) Reswap(strategy string) *HXResponse {
+	h.w.Header().Set("HX-Reswap", strategy)
+	return h
+}
+
+// Trigger sets HX-Trigger, telling htmx to fire a client-side event once the
+// response is swapped in (e.g. to refresh an unrelated part of the page).
+func (h *HXResponse) Trigger(event string) *HXResponse {
+	h.w.Header().Set("HX-Trigger", event)
+	return h
+}
+
+// Render renders templateName for h's request: as a single named fragment
+// if the request carries htmx's HX-Target or Unpoly's X-Up-Target header
+// (see blockFromTargetHeader for how the header's CSS selector becomes a
+// block name), or as the full page -- with templates.Templates.ExecuteTemplate's
+// usual layout-stripping for a bare HX-Request -- otherwise.
+func (h *HXResponse) Render(templateName string, data interface{}) error {
+	if block := blockFromTargetHeader(h.r); block != "" {
+		return h.tmpls.RenderFragment(h.w, h.r, templateName, block, data)
+	}
+	return h.tmpls.ExecuteTemplate(h.w, h.r, templateName, data)
+}
+
+// RenderBlocks renders several blocks from templateName at once via
+// templates.Templates.RenderFragments: concatenated HTML, or, for a request
+// that sent Accept: text/vnd.turbo-stream.html, one
+// `<turbo-stream action="replace">` element per block.
+func (h *HXResponse) RenderBlocks(templateName string, blocks []string, data interface{}) error {
+	return h.tmpls.RenderFragments(h.w, h.r, templateName, blocks, data)
+}
+
+// blockFromTargetHeader derives a block name (as RenderFragment expects it,
+// e.g. "_flash") from htmx's HX-Target or Unpoly's X-Up-Target header --
+// both name a CSS id selector ("#flash") rather than a block name. It
+// strips a leading "#" or "." and adds the "_" prefix ParseTemplates gives
+// every block if the selector doesn't already have one. Returns "" if
+// neither header is present, e.g. a boosted full-page load.
+func blockFromTargetHeader(r *http.Request) string {
+	target := r.Header.Get("HX-Target")
+	if target == "" {
+		target = r.Header.Get("X-Up-Target")
+	}
+	if target == "" {
+		return ""
+	}
+	target = strings.TrimPrefix(strings.TrimPrefix(target, "#"), ".")
+	if !strings.HasPrefix(target, "_") {
+		target = "_" + target
+	}
+	return target
+}
@@ -0,0 +1,113 @@
+package chirender
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dryaf/templates"
+)
+
+func newHXFixture(t *testing.T) *templates.Templates {
+	tmpDir, err := os.MkdirTemp("", "chirender_hx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}{{block "page" .}}{{end}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "users.gohtml", `{{define "page"}}User: {{.}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "blocks"), "flash.gohtml", `{{define "_flash"}}Flash: {{.}}{{end}}`)
+
+	tmpls := templates.NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+	return tmpls
+}
+
+func TestHX_FullPageRender(t *testing.T) {
+	tmpls := newHXFixture(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/users/5", nil)
+	w := httptest.NewRecorder()
+
+	if err := HX(tmpls, w, r).Push("/users/5").Render("users", "Alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Header().Get("HX-Push-Url") != "/users/5" {
+		t.Errorf("expected HX-Push-Url to be set, got headers %v", w.Header())
+	}
+	if !strings.Contains(w.Body.String(), "User: Alice") {
+		t.Errorf("expected the full page rendered, got %q", w.Body.String())
+	}
+}
+
+func TestHX_TargetHeaderRendersFragment(t *testing.T) {
+	tmpls := newHXFixture(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/users/5", nil)
+	r.Header.Set("HX-Request", "true")
+	r.Header.Set("HX-Target", "#flash")
+	w := httptest.NewRecorder()
+
+	if err := HX(tmpls, w, r).Retarget("#flash").Reswap("innerHTML").Render("users", "Alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Header().Get("HX-Retarget") != "#flash" || w.Header().Get("HX-Reswap") != "innerHTML" {
+		t.Errorf("expected HX-Retarget/HX-Reswap to be set, got headers %v", w.Header())
+	}
+	if !strings.Contains(w.Body.String(), "Flash: Alice") {
+		t.Errorf("expected only the _flash block rendered, got %q", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "User: Alice") {
+		t.Errorf("expected the full page not to be rendered, got %q", w.Body.String())
+	}
+}
+
+func TestHX_RenderBlocks(t *testing.T) {
+	tmpls := newHXFixture(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/users/5", nil)
+	w := httptest.NewRecorder()
+
+	if err := HX(tmpls, w, r).RenderBlocks("users", []string{"_flash"}, "Alice"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.Body.String(), "Flash: Alice") {
+		t.Errorf("expected the _flash block rendered, got %q", w.Body.String())
+	}
+}
+
+func TestBlockFromTargetHeader(t *testing.T) {
+	cases := []struct {
+		hxTarget, upTarget, want string
+	}{
+		{"", "", ""},
+		{"#flash", "", "_flash"},
+		{"", ".flash", "_flash"},
+		{"_flash", "", "_flash"},
+		{"#flash", "#ignored", "_flash"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.hxTarget != "" {
+			r.Header.Set("HX-Target", c.hxTarget)
+		}
+		if c.upTarget != "" {
+			r.Header.Set("X-Up-Target", c.upTarget)
+		}
+		if got := blockFromTargetHeader(r); got != c.want {
+			t.Errorf("blockFromTargetHeader(HX-Target=%q, X-Up-Target=%q) = %q, want %q", c.hxTarget, c.upTarget, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package chirender
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/dryaf/templates"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+// routeNameCtxKey is the context key Route's middleware stores its template
+// name under, for Respond to pick up.
+type routeNameCtxKey struct{}
+
+// Route is per-route middleware that names the template Respond renders for
+// an HTML-accepting request, overriding the name Respond would otherwise
+// derive from the chi route pattern (see routeTemplateName). Mount it with
+// chi's With:
+//
+//	r.With(chirender.Route("users/show")).Get("/users/{id}", h)
+//
+// Named Route instead of Template (the render.Renderer type this package
+// already exports) to avoid shadowing it.
+func Route(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), routeNameCtxKey{}, name)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Respond performs content negotiation for data against a single handler
+// call: an HTML-accepting client (browser navigation, or an explicit
+// Accept: text/html) gets data rendered through tmpls as a page -- named by
+// the nearest Route middleware, or derived from the chi route pattern if
+// none was set -- while a JSON/XML/event-stream/form client falls through
+// to render.Respond's usual encoders with the same data, unchanged. Either
+// way, render.Status(r, code) set earlier in the handler still wins: Respond
+// doesn't touch it, it only decides HTML vs. everything else.
+func Respond(tmpls *templates.Templates, w http.ResponseWriter, r *http.Request, data interface{}) {
+	if !wantsHTML(r) {
+		render.Respond(w, r, data)
+		return
+	}
+	name, ok := r.Context().Value(routeNameCtxKey{}).(string)
+	if !ok {
+		name = routeTemplateName(r)
+	}
+	HTML(w, r, New(tmpls, name, data))
+}
+
+// wantsHTML reports whether r's Accept header prefers text/html over the
+// JSON/XML/form/event-stream types render.Respond's default encoders
+// already negotiate among. A missing or wildcard Accept header -- what a
+// plain browser address-bar navigation sends -- is treated as wanting HTML,
+// since that's overwhelmingly the caller in that case.
+func wantsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" || accept == "*/*" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		switch strings.TrimSpace(strings.SplitN(part, ";", 2)[0]) {
+		case "text/html", "application/xhtml+xml":
+			return true
+		case "application/json", "application/xml", "text/xml", "text/event-stream", "application/x-www-form-urlencoded":
+			return false
+		}
+	}
+	return false
+}
+
+// routeTemplateName derives a page name from r's chi route pattern, e.g.
+// "/users/{id}/posts/{postID}" becomes "users/posts" -- parameter segments
+// carry no naming information of their own, so they're dropped rather than
+// guessed at. Falls back to "index" for "/" or a request chi has no route
+// context for (e.g. a unit test driving a handler directly).
+func routeTemplateName(r *http.Request) string {
+	pattern := ""
+	if rc := chi.RouteContext(r.Context()); rc != nil {
+		pattern = rc.RoutePattern()
+	}
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return "index"
+	}
+
+	segments := strings.Split(pattern, "/")
+	kept := segments[:0]
+	for _, seg := range segments {
+		if strings.HasPrefix(seg, "{") {
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	if len(kept) == 0 {
+		return "index"
+	}
+	return strings.Join(kept, "/")
+}
@@ -0,0 +1,115 @@
+package chirender
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dryaf/templates"
+	"github.com/go-chi/chi/v5"
+)
+
+func newRespondFixture(t *testing.T) *templates.Templates {
+	tmpDir, err := os.MkdirTemp("", "chirender_respond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}{{block "page" .}}{{end}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "users.gohtml", `{{define "page"}}User: {{.}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "index.gohtml", `{{define "page"}}Home: {{.}}{{end}}`)
+
+	tmpls := templates.NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+	return tmpls
+}
+
+func TestRespond_HTML(t *testing.T) {
+	tmpls := newRespondFixture(t)
+
+	r := chi.NewRouter()
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		Respond(tmpls, w, r, "Alice")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/5", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "User: Alice") {
+		t.Errorf("expected the 'users' page rendered from the route pattern, got %q", w.Body.String())
+	}
+}
+
+func TestRespond_JSONFallsThrough(t *testing.T) {
+	tmpls := newRespondFixture(t)
+
+	r := chi.NewRouter()
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		Respond(tmpls, w, r, map[string]string{"name": "Alice"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/5", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"name":"Alice"`) {
+		t.Errorf("expected JSON fallback, got %q", w.Body.String())
+	}
+}
+
+func TestRespond_RouteOverride(t *testing.T) {
+	tmpls := newRespondFixture(t)
+
+	r := chi.NewRouter()
+	r.With(Route("index")).Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		Respond(tmpls, w, r, "Alice")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/5", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), "Home: Alice") {
+		t.Errorf("expected Route(\"index\") to override the route-derived name, got %q", w.Body.String())
+	}
+}
+
+func TestRouteTemplateName(t *testing.T) {
+	cases := []struct {
+		pattern, want string
+	}{
+		{"/", "index"},
+		{"/users/{id}", "users"},
+		{"/users/{id}/posts/{postID}", "users/posts"},
+	}
+	for _, c := range cases {
+		rc := chi.NewRouteContext()
+		rc.RoutePatterns = []string{c.pattern}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rc))
+		if got := routeTemplateName(req); got != c.want {
+			t.Errorf("routeTemplateName(%q) = %q, want %q", c.pattern, got, c.want)
+		}
+	}
+}
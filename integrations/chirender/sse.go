@@ -0,0 +1,134 @@
+package chirender
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dryaf/templates"
+)
+
+// SSEWriter renders templates as Server-Sent Events frames over an already
+// open response. See SSE.
+type SSEWriter struct {
+	tmpls   *templates.Templates
+	w       http.ResponseWriter
+	r       *http.Request
+	flusher http.Flusher
+}
+
+// SSE starts a Server-Sent Events stream on w: sets Content-Type:
+// text/event-stream, Cache-Control: no-cache, Connection: keep-alive and
+// X-Accel-Buffering: no (so an nginx reverse proxy in front of the app
+// doesn't buffer the whole response before forwarding it), then writes the
+// response header. The returned *SSEWriter's Send renders a template per
+// event; a handler keeps calling Send/SendRaw/Comment/Retry until r's
+// context is done (the client disconnected), at which point every further
+// call returns r.Context().Err() instead of writing.
+func SSE(tmpls *templates.Templates, w http.ResponseWriter, r *http.Request) *SSEWriter {
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	s := &SSEWriter{tmpls: tmpls, w: w, r: r}
+	s.flusher, _ = w.(http.Flusher)
+	s.flush()
+	return s
+}
+
+// Send renders name against data and emits it as one SSE frame tagged with
+// event. name is rendered through RenderBlockAsHTMLString if it starts with
+// "_" (a block, e.g. for HTMX's sse-swap extension, which swaps in one
+// block per event) or Templates.ExecuteTemplateAsText otherwise (a full
+// page, in the rarer case an event replaces the whole document).
+func (s *SSEWriter) Send(event, name string, data any) error {
+	body, err := s.render(name, data)
+	if err != nil {
+		return err
+	}
+	return s.SendRaw(event, body)
+}
+
+func (s *SSEWriter) render(name string, data any) (string, error) {
+	if strings.HasPrefix(name, "_") {
+		html, err := s.tmpls.RenderBlockAsHTMLString(name, data)
+		return html.String(), err
+	}
+	return s.tmpls.ExecuteTemplateAsText(s.r, name, data)
+}
+
+// SendRaw emits data as one SSE frame tagged with event (omitted if ""),
+// splitting data on "\n" into one "data: " line per line per the SSE spec
+// (a single "data:" line can't itself contain a newline).
+func (s *SSEWriter) SendRaw(event, data string) error {
+	if err := s.closed(); err != nil {
+		return err
+	}
+	var b strings.Builder
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteByte('\n')
+	if _, err := io.WriteString(s.w, b.String()); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+// Retry tells the client how long to wait before reconnecting after the
+// stream closes, via SSE's "retry:" field (in milliseconds, per spec).
+func (s *SSEWriter) Retry(d time.Duration) error {
+	if err := s.closed(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(s.w, "retry: %d\n\n", d.Milliseconds())
+	s.flush()
+	return err
+}
+
+// Comment writes c as an SSE comment line (": ..."), invisible to the
+// client's event listeners -- useful as a keep-alive to hold a connection
+// open through proxies that time out an idle stream.
+func (s *SSEWriter) Comment(c string) error {
+	if err := s.closed(); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(c, "\n") {
+		fmt.Fprintf(&b, ": %s\n", line)
+	}
+	b.WriteByte('\n')
+	_, err := io.WriteString(s.w, b.String())
+	s.flush()
+	return err
+}
+
+// closed reports r.Context().Err() once the client has disconnected, so a
+// handler's Send/SendRaw/Comment/Retry loop can stop cleanly instead of
+// writing into a dead connection.
+func (s *SSEWriter) closed() error {
+	if s.r == nil {
+		return nil
+	}
+	select {
+	case <-s.r.Context().Done():
+		return s.r.Context().Err()
+	default:
+		return nil
+	}
+}
+
+func (s *SSEWriter) flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
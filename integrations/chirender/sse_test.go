@@ -0,0 +1,111 @@
+package chirender
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dryaf/templates"
+)
+
+func newSSEFixture(t *testing.T) *templates.Templates {
+	tmpDir, err := os.MkdirTemp("", "chirender_sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}{{block "page" .}}{{end}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "ticker.gohtml", `{{define "page"}}Ticker: {{.}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "blocks"), "price.gohtml", `{{define "_price"}}Price: {{.}}{{end}}`)
+
+	tmpls := templates.NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+	return tmpls
+}
+
+func TestSSE_SendBlock(t *testing.T) {
+	tmpls := newSSEFixture(t)
+	r := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	w := httptest.NewRecorder()
+
+	s := SSE(tmpls, w, r)
+	if err := s.Send("price-update", "_price", "$42"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("expected Cache-Control: no-cache, got %q", cc)
+	}
+
+	want := "event: price-update\ndata: Price: $42\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got frame %q, want %q", got, want)
+	}
+}
+
+func TestSSE_MultilineDataEscaped(t *testing.T) {
+	tmpls := newSSEFixture(t)
+	r := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	w := httptest.NewRecorder()
+
+	s := SSE(tmpls, w, r)
+	if err := s.SendRaw("note", "line one\nline two"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "event: note\ndata: line one\ndata: line two\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got frame %q, want %q", got, want)
+	}
+}
+
+func TestSSE_RetryAndComment(t *testing.T) {
+	tmpls := newSSEFixture(t)
+	r := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	w := httptest.NewRecorder()
+
+	s := SSE(tmpls, w, r)
+	if err := s.Retry(3 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Comment("keep-alive"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "retry: 3000\n\n: keep-alive\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSSE_StopsAfterContextDone(t *testing.T) {
+	tmpls := newSSEFixture(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/stream", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	s := SSE(tmpls, w, r)
+	cancel()
+
+	if err := s.SendRaw("tick", "still alive"); err == nil {
+		t.Fatal("expected an error once the client's context is done")
+	}
+	if strings.Contains(w.Body.String(), "still alive") {
+		t.Errorf("expected nothing written after context cancellation, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,153 @@
+package chirender
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dryaf/templates"
+)
+
+// DefaultBlockTimeout bounds how long Stream waits for a StreamBlock's
+// Resolver before giving up, for a block that doesn't set its own Timeout.
+const DefaultBlockTimeout = 10 * time.Second
+
+// Resolver is implemented by a StreamBlock's Data when it isn't ready yet --
+// e.g. a slow database query or upstream call. Stream calls Resolve
+// concurrently for every block up front, each under its own per-block
+// timeout, then renders and flushes the blocks in order as their data
+// becomes available.
+type Resolver interface {
+	Resolve(ctx context.Context) (any, error)
+}
+
+// StreamBlock names one block to render from templateName, along with the
+// data (or Resolver) to render it with.
+type StreamBlock struct {
+	Name    string
+	Data    any
+	Timeout time.Duration // 0 means DefaultBlockTimeout
+}
+
+// Stream renders templateName's blocks one at a time, flushing the response
+// after each so a browser can start painting the head/above-the-fold blocks
+// while slower ones are still resolving. A block whose Data implements
+// Resolver is resolved concurrently with every other block as soon as
+// Stream is called (each under its own Timeout), so a slow block at the top
+// of the page doesn't hold up a fast one further down from starting its own
+// resolution -- only from being flushed before it, since blocks still have
+// to reach the client in order for a single HTML document to parse
+// correctly in a streaming browser. Falls back to rendering every block
+// into one buffered, non-streaming response if w doesn't implement
+// http.Flusher.
+//
+// This is a deliberately narrower tool than a full `{{ defer "block" .Promise }}`
+// template construct: there's no new template syntax, no out-of-order
+// delivery, and no hx-swap-oob/Turbo Stream wrapping -- callers who want
+// out-of-order delivery can already get it by pairing Stream's blocks with
+// separate requests rendered through HXResponse.RenderBlocks or RenderFragments.
+// What Stream adds on top of those is concurrent resolution plus in-order
+// flushing within a single response.
+func Stream(tmpls *templates.Templates, w http.ResponseWriter, r *http.Request, templateName string, blocks []StreamBlock) error {
+	flusher, canFlush := w.(http.Flusher)
+	if !canFlush {
+		return renderBlocksBuffered(tmpls, w, r, templateName, blocks)
+	}
+
+	type resolved struct {
+		data any
+		err  error
+	}
+	results := make([]chan resolved, len(blocks))
+	for i, block := range blocks {
+		ch := make(chan resolved, 1)
+		results[i] = ch
+		go func(block StreamBlock, ch chan resolved) {
+			data, err := resolveBlockData(r.Context(), block.Data, block.Timeout)
+			ch <- resolved{data, err}
+		}(block, ch)
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for i, block := range blocks {
+		res := <-results[i]
+		if res.err != nil {
+			return fmt.Errorf("chirender: resolving block %q: %w", block.Name, res.err)
+		}
+		if err := tmpls.RenderFragmentWithStatus(w, r, 0, templateName, block.Name, res.data); err != nil {
+			return err
+		}
+		flusher.Flush()
+	}
+	return nil
+}
+
+// renderBlocksBuffered is Stream's fallback for a ResponseWriter that can't
+// flush (or a reverse proxy that would buffer the response regardless):
+// resolve every block concurrently same as Stream, but only write the
+// response once everything is ready, rendering each block with
+// RenderFragmentWithStatus into one BufferedResponseWriter.
+func renderBlocksBuffered(tmpls *templates.Templates, w http.ResponseWriter, r *http.Request, templateName string, blocks []StreamBlock) error {
+	type resolved struct {
+		data any
+		err  error
+	}
+	results := make([]chan resolved, len(blocks))
+	names := make([]string, len(blocks))
+	for i, block := range blocks {
+		names[i] = block.Name
+		ch := make(chan resolved, 1)
+		results[i] = ch
+		go func(block StreamBlock, ch chan resolved) {
+			data, err := resolveBlockData(r.Context(), block.Data, block.Timeout)
+			ch <- resolved{data, err}
+		}(block, ch)
+	}
+
+	data := make([]any, len(blocks))
+	for i, block := range blocks {
+		res := <-results[i]
+		if res.err != nil {
+			return fmt.Errorf("chirender: resolving block %q: %w", block.Name, res.err)
+		}
+		data[i] = res.data
+	}
+
+	// RenderFragments takes one data value for every block, so a buffered
+	// fallback with mixed per-block data falls back to the first block's
+	// data only if there's just one block; multiple blocks with different
+	// data are rendered one at a time instead.
+	if len(blocks) == 1 {
+		return tmpls.RenderFragmentWithStatus(w, r, http.StatusOK, templateName, names[0], data[0])
+	}
+	bw := tmpls.NewBufferedResponseWriter(w)
+	for i, name := range names {
+		if err := tmpls.RenderFragmentWithStatus(bw, r, 0, templateName, name, data[i]); err != nil {
+			bw.Release()
+			return err
+		}
+	}
+	return bw.Finish(tmpls, r, http.StatusOK)
+}
+
+// resolveBlockData returns data unchanged unless it implements Resolver, in
+// which case it calls Resolve under a context derived from parent with a
+// timeout of timeout (or DefaultBlockTimeout if timeout is 0).
+func resolveBlockData(parent context.Context, data any, timeout time.Duration) (any, error) {
+	resolver, ok := data.(Resolver)
+	if !ok {
+		return data, nil
+	}
+	if timeout <= 0 {
+		timeout = DefaultBlockTimeout
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	return resolver.Resolve(ctx)
+}
@@ -0,0 +1,129 @@
+package chirender
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dryaf/templates"
+)
+
+func newStreamFixture(t *testing.T) *templates.Templates {
+	tmpDir, err := os.MkdirTemp("", "chirender_stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}{{block "page" .}}{{end}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "dashboard.gohtml", `{{define "page"}}dashboard{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "blocks"), "header.gohtml", `{{define "_header"}}Header: {{.}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "blocks"), "stats.gohtml", `{{define "_stats"}}Stats: {{.}}{{end}}`)
+
+	tmpls := templates.NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+	return tmpls
+}
+
+type slowResolver struct {
+	delay time.Duration
+	value any
+	err   error
+}
+
+func (s slowResolver) Resolve(ctx context.Context) (any, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.value, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flushRecorder wraps httptest.ResponseRecorder to count Flush calls --
+// ResponseRecorder already implements http.Flusher, this just observes it.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (f *flushRecorder) Flush() { f.flushes++ }
+
+func TestStream_FlushesEachBlock(t *testing.T) {
+	tmpls := newStreamFixture(t)
+	r := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	blocks := []StreamBlock{
+		{Name: "_header", Data: "Alice"},
+		{Name: "_stats", Data: slowResolver{delay: 10 * time.Millisecond, value: "42 views"}},
+	}
+	if err := Stream(tmpls, w, r, "dashboard", blocks); err != nil {
+		t.Fatal(err)
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, "Header: Alice") || !strings.Contains(body, "Stats: 42 views") {
+		t.Errorf("expected both blocks rendered, got %q", body)
+	}
+	if w.flushes < len(blocks) {
+		t.Errorf("expected at least %d flushes, got %d", len(blocks), w.flushes)
+	}
+}
+
+func TestStream_ResolverTimeout(t *testing.T) {
+	tmpls := newStreamFixture(t)
+	r := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	blocks := []StreamBlock{
+		{Name: "_stats", Data: slowResolver{delay: 50 * time.Millisecond, value: "42"}, Timeout: 5 * time.Millisecond},
+	}
+	err := Stream(tmpls, w, r, "dashboard", blocks)
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a context.DeadlineExceeded error, got %v", err)
+	}
+}
+
+// nonFlushingWriter wraps an httptest.ResponseRecorder but deliberately
+// doesn't forward its Flush method, so it satisfies only http.ResponseWriter
+// -- ResponseRecorder itself implements http.Flusher, which would bypass
+// Stream's buffered fallback entirely.
+type nonFlushingWriter struct {
+	rec *httptest.ResponseRecorder
+}
+
+func (w *nonFlushingWriter) Header() http.Header         { return w.rec.Header() }
+func (w *nonFlushingWriter) Write(p []byte) (int, error) { return w.rec.Write(p) }
+func (w *nonFlushingWriter) WriteHeader(status int)      { w.rec.WriteHeader(status) }
+
+func TestStream_BufferedFallback(t *testing.T) {
+	tmpls := newStreamFixture(t)
+	r := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+	rec := httptest.NewRecorder()
+	w := &nonFlushingWriter{rec: rec}
+
+	blocks := []StreamBlock{
+		{Name: "_header", Data: "Bob"},
+		{Name: "_stats", Data: "7 views"},
+	}
+	if err := Stream(tmpls, w, r, "dashboard", blocks); err != nil {
+		t.Fatal(err)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "Header: Bob") || !strings.Contains(body, "Stats: 7 views") {
+		t.Errorf("expected both blocks rendered in the buffered fallback, got %q", body)
+	}
+}
@@ -3,7 +3,11 @@
 package echo
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"net/http"
+	"runtime/debug"
 
 	"github.com/dryaf/templates"
 	"github.com/labstack/echo/v4"
@@ -16,7 +20,15 @@ type echoRenderer struct {
 }
 
 // Render executes the template and writes its output to the provided writer.
-// It is called by c.Render() in an Echo handler.
+// It is called by c.Render() in an Echo handler. Echo's own Context.Render
+// already renders into its own bytes.Buffer before committing a status code
+// and body, so w here is never the real http.ResponseWriter -- a render
+// error here can't leave a partial response on the wire either way. One
+// consequence is that templates.Templates.Compression's ETag and
+// Accept-Encoding negotiation can't apply through c.Render(), since it needs
+// the real ResponseWriter to set headers before Echo writes the status;
+// render compressed responses by calling Templates.ExecuteTemplate(c.Response(), ...)
+// directly from a handler instead of through c.Render() if that's needed.
 func (e *echoRenderer) Render(w io.Writer, name string, data interface{}, ctx echo.Context) error {
 	return e.ExecuteTemplate(w, ctx.Request(), name, data)
 }
@@ -33,14 +45,106 @@ func Renderer(t *templates.Templates) echo.Renderer {
 	return &echoRenderer{t}
 }
 
-// MethodOverrideFormField is a convenience function that returns Echo's
-// MethodOverride middleware configured to look for the method in a form field.
+// MethodOverrideFormField is a convenience function that returns Echo's own
+// MethodOverride middleware configured to look for the method in a form
+// field. It's independent of templates.MethodOverride; prefer CSRF below
+// (backed by templates.CSRF) if the page is also using {{csrf_token}}/
+// {{csrf_field}}, since Echo's own CSRF middleware doesn't know about them.
 func MethodOverrideFormField(fieldName string) echo.MiddlewareFunc {
 	return middleware.MethodOverrideWithConfig(middleware.MethodOverrideConfig{Getter: middleware.MethodFromForm(fieldName)})
 }
 
-// CSRFTokenLookup is a convenience function that returns Echo's CSRF middleware
-// configured with the specified token lookup method (e.g., "form:_csrf").
+// CSRFTokenLookup is a convenience function that returns Echo's own CSRF
+// middleware configured with the specified token lookup method (e.g.,
+// "form:_csrf"). It's independent of templates.CSRF and doesn't populate
+// {{csrf_token}}/{{csrf_field}}; use CSRF below for that.
 func CSRFTokenLookup(lookupMethod string) echo.MiddlewareFunc {
 	return middleware.CSRFWithConfig(middleware.CSRFConfig{TokenLookup: lookupMethod})
 }
+
+// CSRF adapts c.Middleware to Echo, issuing and validating the CSRF token
+// {{csrf_token}}/{{csrf_field}} render, via echo.WrapMiddleware:
+//
+//	csrf := tmpls.EnableCSRF(templates.CookieSessionStore{}, "csrf_token")
+//	e.Use(templates_echo.CSRF(csrf))
+func CSRF(c *templates.CSRF) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(c.Middleware)
+}
+
+// MethodOverride adapts templates.MethodOverride(formField) to Echo.
+func MethodOverride(formField string) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(templates.MethodOverride(formField))
+}
+
+// Flash adapts templates.FlashMiddleware(store, categories...) to Echo.
+func Flash(store templates.SessionStore, categories ...string) echo.MiddlewareFunc {
+	return echo.WrapMiddleware(templates.FlashMiddleware(store, categories...))
+}
+
+// Recover returns Echo middleware that recovers a panic from the rest of the
+// handler chain and renders it as a themed error page via
+// templates.Templates.RenderError, making the recovered stack trace
+// available to it through templates.StackTraceContextKey. This is an
+// Echo-native equivalent of templates.Templates.Recoverer, which is for
+// net/http-compatible routers (chi, chirender) instead.
+func Recover(t *templates.Templates) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				recErr, ok := rec.(error)
+				if !ok {
+					recErr = fmt.Errorf("%v", rec)
+				}
+				ctx := context.WithValue(c.Request().Context(), templates.StackTraceContextKey{}, string(debug.Stack()))
+				t.RenderError(c.Response(), c.Request().WithContext(ctx), http.StatusInternalServerError, recErr)
+			}()
+			return next(c)
+		}
+	}
+}
+
+// RenderFormat executes name in the given format, bypassing the content
+// negotiation templates.Templates.ExecuteTemplate would otherwise run via
+// ResolveOutputFormat, and writes it to the response. Use it for a route
+// that always serves one format, e.g. a feed handler that should render
+// "rss" even for a client that sends no Accept header or URL suffix.
+func RenderFormat(t *templates.Templates, c echo.Context, name, format string, data interface{}) error {
+	return t.ExecuteFormat(c.Response(), c.Request(), name, format, data)
+}
+
+// RenderFragment executes a single `{{define "block"}}...{{end}}` from the
+// named template and writes it to the response, suitable for an htmx/Unpoly
+// partial update handler.
+func RenderFragment(t *templates.Templates, c echo.Context, name, block string, data interface{}) error {
+	return t.RenderFragment(c.Response(), c.Request(), name, block, data)
+}
+
+// RenderFragments executes several blocks from the named template and
+// writes them to the response, concatenated as plain HTML or, for a
+// text/vnd.turbo-stream.html Accept header, as Turbo Stream elements. See
+// templates.Templates.RenderFragments.
+func RenderFragments(t *templates.Templates, c echo.Context, name string, blocks []string, data interface{}) error {
+	return t.RenderFragments(c.Response(), c.Request(), name, blocks, data)
+}
+
+// NewHTTPErrorHandler returns an echo.HTTPErrorHandler that renders themed
+// error pages via templates.Templates.RenderError. Install it once at
+// startup to replace Echo's default error handler:
+//
+//	e.HTTPErrorHandler = templates_echo.NewHTTPErrorHandler(tmpls)
+func NewHTTPErrorHandler(t *templates.Templates) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+		status := http.StatusInternalServerError
+		if he, ok := err.(*echo.HTTPError); ok {
+			status = he.Code
+		}
+		t.RenderError(c.Response(), c.Request(), status, err)
+	}
+}
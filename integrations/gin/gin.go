@@ -3,9 +3,11 @@
 package gin
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/dryaf/templates"
+	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/render"
 )
 
@@ -20,6 +22,11 @@ func New(tmpls *templates.Templates) *Renderer {
 }
 
 // Instance returns a gin.HTMLRender instance for a given template name and data.
+// Gin's render.HTMLRender interface never passes it a *gin.Context, so the
+// instance it returns has no *http.Request to give ExecuteTemplate -- which
+// means LayoutContextKey-driven layout selection and Compression's
+// conditional-GET/Accept-Encoding negotiation don't work through c.HTML().
+// Use Render below instead wherever either of those matters.
 func (r *Renderer) Instance(name string, data interface{}) render.Render {
 	return &instance{
 		Templates: r.Templates,
@@ -28,6 +35,32 @@ func (r *Renderer) Instance(name string, data interface{}) render.Render {
 	}
 }
 
+// Render renders name with c.Request (so LayoutContextKey-driven layout
+// selection and Compression's conditional-GET/Accept-Encoding negotiation
+// work, unlike Instance/c.HTML) into a pooled buffer, then writes status
+// and the rendered body to c.Writer:
+//
+//	router.Use(func(c *gin.Context) {
+//		ctx := context.WithValue(c.Request.Context(), templates.LayoutContextKey{}, "special")
+//		c.Request = c.Request.WithContext(ctx)
+//		c.Next()
+//	})
+//	router.GET("/admin/dashboard", func(c *gin.Context) {
+//		renderer.Render(c, http.StatusOK, "person", data)
+//	})
+//
+// On error it panics, same as instance.Render, so Gin's recovery middleware
+// turns it into a 500.
+func (r *Renderer) Render(c *gin.Context, status int, name string, data interface{}) error {
+	bw := r.Templates.NewBufferedResponseWriter(c.Writer)
+	bw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := r.Templates.ExecuteTemplate(bw, c.Request, name, data); err != nil {
+		bw.Release()
+		panic(err)
+	}
+	return bw.Finish(r.Templates, c.Request, status)
+}
+
 // instance is a specific render instance for a single request.
 type instance struct {
 	Templates *templates.Templates
@@ -35,24 +68,117 @@ type instance struct {
 	Data      interface{}
 }
 
-// Render writes the template execution results to the writer.
+// Render renders the template into a pooled buffer and, once that succeeds,
+// writes it to w. Buffering first means a template execution error never
+// leaves a partial response on the wire, and lets templates.Templates.Compression
+// apply an ETag over the complete body.
 // If an error occurs, it panics to allow Gin's recovery middleware to handle it.
 func (i *instance) Render(w http.ResponseWriter) error {
 	i.WriteContentType(w)
 
+	bw := i.Templates.NewBufferedResponseWriter(w)
 	// The gin render interface doesn't provide access to the http.Request,
-	// so we pass nil. This means layout selection from context is not supported
-	// in the Gin integration.
-	err := i.Templates.ExecuteTemplate(w, nil, i.Name, i.Data)
-	if err != nil {
-		// The template engine logs detailed errors. A panic is the idiomatic way
-		// to signal a 500 Internal Server Error to Gin's recovery middleware.
+	// so we pass nil. This means layout selection from context, and
+	// Templates.Compression's conditional-GET/Accept-Encoding negotiation,
+	// are not supported in the Gin integration.
+	if err := i.Templates.ExecuteTemplate(bw, nil, i.Name, i.Data); err != nil {
+		bw.Release()
+		// The template engine logs detailed errors. A panic is the idiomatic
+		// way to signal a 500 Internal Server Error to Gin's recovery middleware.
 		panic(err)
 	}
-	return nil
+	// gin.Context.Render already wrote the status via c.Status before
+	// calling this, so 0 here just means "don't override it".
+	return bw.Finish(i.Templates, nil, 0)
 }
 
 // WriteContentType writes the Content-Type header.
 func (i *instance) WriteContentType(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 }
+
+// RenderFragment executes a single `{{define "block"}}...{{end}}` from the
+// named template and writes it to the response, suitable for an htmx/Unpoly
+// partial update handler.
+func (r *Renderer) RenderFragment(c *gin.Context, name, block string, data interface{}) error {
+	return r.Templates.RenderFragment(c.Writer, c.Request, name, block, data)
+}
+
+// RenderFragments executes several blocks from the named template and
+// writes them to the response, concatenated as plain HTML or, for a
+// text/vnd.turbo-stream.html Accept header, as Turbo Stream elements. See
+// templates.Templates.RenderFragments.
+func (r *Renderer) RenderFragments(c *gin.Context, name string, blocks []string, data interface{}) error {
+	return r.Templates.RenderFragments(c.Writer, c.Request, name, blocks, data)
+}
+
+// RecoveryWithTemplates returns a gin.HandlerFunc that recovers from panics in
+// later handlers and renders a themed 500 error page via
+// templates.Templates.RenderError, instead of Gin's plain-text default.
+// Install it in place of gin.Recovery():
+//
+//	router.Use(templates_gin.RecoveryWithTemplates(tmpls))
+func RecoveryWithTemplates(t *templates.Templates) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				err, ok := rec.(error)
+				if !ok {
+					err = fmt.Errorf("%v", rec)
+				}
+				t.RenderError(c.Writer, c.Request, http.StatusInternalServerError, err)
+				c.Abort()
+			}
+		}()
+		c.Next()
+	}
+}
+
+// RecoveryFunc adapts t.RenderError to gin.RecoveryFunc's signature, for
+// plugging this package into gin.CustomRecoveryWithWriter instead of
+// RecoveryWithTemplates, e.g. to keep Gin's own panic logging:
+//
+//	router.Use(gin.CustomRecoveryWithWriter(os.Stderr, templates_gin.RecoveryFunc(tmpls)))
+func RecoveryFunc(t *templates.Templates) func(c *gin.Context, err interface{}) {
+	return func(c *gin.Context, rec interface{}) {
+		err, ok := rec.(error)
+		if !ok {
+			err = fmt.Errorf("%v", rec)
+		}
+		t.RenderError(c.Writer, c.Request, http.StatusInternalServerError, err)
+		c.Abort()
+	}
+}
+
+// wrapNetHTTP adapts a net/http middleware to gin.HandlerFunc, running mw
+// around the rest of the chain and writing back c.Request in case mw
+// replaced it (as templates.MethodOverride and (*templates.CSRF).Middleware
+// both do, via r.WithContext/r.Method).
+func wrapNetHTTP(mw func(http.Handler) http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Request = r
+			c.Next()
+		})).ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// CSRF adapts c.Middleware to gin, issuing and validating the CSRF token
+// templates_gin's Renderer's templates render via {{csrf_token}}/
+// {{csrf_field}}:
+//
+//	csrf := tmpls.EnableCSRF(templates.CookieSessionStore{}, "csrf_token")
+//	router.Use(templates_gin.CSRF(csrf))
+func CSRF(c *templates.CSRF) gin.HandlerFunc {
+	return wrapNetHTTP(c.Middleware)
+}
+
+// MethodOverride adapts templates.MethodOverride(formField) to gin.
+func MethodOverride(formField string) gin.HandlerFunc {
+	return wrapNetHTTP(templates.MethodOverride(formField))
+}
+
+// Flash adapts templates.FlashMiddleware(store, categories...) to gin.
+func Flash(store templates.SessionStore, categories ...string) gin.HandlerFunc {
+	return wrapNetHTTP(templates.FlashMiddleware(store, categories...))
+}
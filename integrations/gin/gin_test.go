@@ -2,6 +2,7 @@
 package gin
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
@@ -110,6 +111,37 @@ func TestRenderWithLayout(t *testing.T) {
 	}
 }
 
+func TestRenderer_Render_ContextLayout(t *testing.T) {
+	r, tmpls := setup(t)
+	renderer := New(tmpls)
+
+	r.Use(func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), templates.LayoutContextKey{}, "special")
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	})
+	r.GET("/admin/dashboard", func(c *gin.Context) {
+		if err := renderer.Render(c, http.StatusOK, "person", &Person{Name: "Admin (from Gin context)", Age: 101}); err != nil {
+			t.Errorf("renderer.Render failed: %v", err)
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/dashboard", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Special-Layout:") {
+		t.Error("Expected the layout selected via LayoutContextKey to be used, since Render (unlike c.HTML/Instance) propagates c.Request")
+	}
+	if !strings.Contains(body, "Name: Admin (from Gin context)") {
+		t.Error("Expected the admin's name to be rendered")
+	}
+}
+
 func TestRenderError(t *testing.T) {
 	r, tmpls := setup(t)
 
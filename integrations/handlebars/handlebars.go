@@ -0,0 +1,140 @@
+// ==== File: integrations/handlebars/handlebars.go ====
+// Package handlebars adapts github.com/aymerick/raymond to templates.Engine,
+// so a project can author some pages in Handlebars (".hbs") alongside
+// ".gohtml" pages parsed by templates.SafehtmlEngine, and hit both through
+// the same templates.Templates.ExecuteTemplate / chi / echo renderer.
+//
+// Handlebars has no equivalent of a single file defining several named
+// `{{define}}` blocks, so this adapter infers a parsed file's role --
+// "layout", "page", or a "_name" block -- from which of the project's
+// conventional LayoutsPath/PagesPath/BlocksPath directories it lives under
+// (by default "layouts", "pages", "blocks"; see templates.DefaultTemplatesConfig).
+// A custom LayoutsPath/PagesPath/BlocksPath whose last path element isn't one
+// of those names won't be recognized.
+package handlebars
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/aymerick/raymond"
+	"github.com/dryaf/templates"
+)
+
+// EngineKind is the templates.EngineKind this package's Engine parses.
+// Map a file extension (conventionally ".hbs") to it on
+// Templates.TemplateFileExtensions and register the Engine itself on
+// Templates.Engines -- or just call Register. See templates.EngineKind.
+const EngineKind templates.EngineKind = "handlebars"
+
+// Extension is the file extension Register maps to EngineKind by default.
+const Extension = ".hbs"
+
+// Engine is a templates.Engine backed by github.com/aymerick/raymond.
+type Engine struct {
+	fs fs.FS
+}
+
+// New constructs an Engine that reads template files from the given
+// filesystem. fsys should be the same filesystem the owning
+// templates.Templates was built from.
+func New(fsys fs.FS) *Engine {
+	return &Engine{fs: fsys}
+}
+
+// Register maps Extension to EngineKind on tmpls.TemplateFileExtensions and
+// adds an Engine reading from fsys to tmpls.Engines, so ".hbs" files are
+// parsed as Handlebars templates alongside any ".gohtml" ones.
+func Register(tmpls *templates.Templates, fsys fs.FS) {
+	if tmpls.TemplateFileExtensions == nil {
+		tmpls.TemplateFileExtensions = map[string]templates.EngineKind{}
+	}
+	tmpls.TemplateFileExtensions[Extension] = EngineKind
+	if tmpls.Engines == nil {
+		tmpls.Engines = map[templates.EngineKind]templates.Engine{}
+	}
+	tmpls.Engines[EngineKind] = New(fsys)
+}
+
+// ParseFiles implements templates.Engine. Every file is parsed as its own
+// Handlebars template, named "layout", "page", or "_<block>" depending on
+// which conventional directory it came from (see the package doc), and every
+// other file in the same call is registered as a partial available to it --
+// matching the project's "one layout + one page + any number of blocks"
+// parse unit.
+func (e *Engine) ParseFiles(fnMap map[string]any, files ...string) (templates.ParsedTemplate, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files in slice")
+	}
+	p := &parsedTemplate{named: map[string]*raymond.Template{}}
+	for _, file := range files {
+		src, err := fs.ReadFile(e.fs, file)
+		if err != nil {
+			return nil, fmt.Errorf("handlebars: reading %s: %w", file, err)
+		}
+		tpl, err := raymond.Parse(string(src))
+		if err != nil {
+			return nil, fmt.Errorf("handlebars: parsing %s: %w", file, err)
+		}
+		for helperName, fn := range fnMap {
+			tpl.RegisterHelper(helperName, fn)
+		}
+		p.named[roleOf(file)] = tpl
+	}
+	for name, tpl := range p.named {
+		for partialName, partialTpl := range p.named {
+			if partialName != name {
+				tpl.RegisterPartialTemplate(partialName, partialTpl)
+			}
+		}
+	}
+	return p, nil
+}
+
+// roleOf derives the template name ParseFiles registers file under, from the
+// name of its immediate parent directory.
+func roleOf(file string) string {
+	switch filepath.Base(filepath.Dir(file)) {
+	case "layouts":
+		return "layout"
+	case "pages":
+		return "page"
+	default: // blocks
+		base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if !strings.HasPrefix(base, "_") {
+			base = "_" + base
+		}
+		return base
+	}
+}
+
+// parsedTemplate adapts a set of named *raymond.Template values to
+// templates.ParsedTemplate.
+type parsedTemplate struct {
+	named map[string]*raymond.Template
+}
+
+func (p *parsedTemplate) ExecuteTemplate(w io.Writer, name string, data any) error {
+	tpl, ok := p.named[name]
+	if !ok {
+		return fmt.Errorf("handlebars: template %q not found", name)
+	}
+	out, err := tpl.Exec(data)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, out)
+	return err
+}
+
+func (p *parsedTemplate) DefinedTemplates() []string {
+	names := make([]string, 0, len(p.named))
+	for name := range p.named {
+		names = append(names, name)
+	}
+	return names
+}
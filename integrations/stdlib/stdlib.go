@@ -30,8 +30,11 @@ func FromTemplates(t *templates.Templates) *Renderer {
 	return &Renderer{t}
 }
 
-// Render executes a template, sets the HTTP status code, and writes the output
-// to the http.ResponseWriter.
+// Render executes a template into a pooled buffer and, once that succeeds,
+// sets the HTTP status code and writes the output to the http.ResponseWriter.
+// Buffering first means a template execution error never leaves a partial
+// response on the wire, and lets templates.Templates.Compression apply an
+// ETag and negotiate Accept-Encoding over the complete body.
 //
 // Parameters:
 //   - w: The http.ResponseWriter to write the rendered output to.
@@ -40,8 +43,12 @@ func FromTemplates(t *templates.Templates) *Renderer {
 //   - name: The template name to render, using the "layout:page" or ":page" syntax.
 //   - data: The data to pass to the template.
 func (r *Renderer) Render(w http.ResponseWriter, req *http.Request, status int, name string, data interface{}) error {
-	w.WriteHeader(status)
-	return r.ExecuteTemplate(w, req, name, data)
+	bw := r.NewBufferedResponseWriter(w)
+	if err := r.ExecuteTemplate(bw, req, name, data); err != nil {
+		bw.Release()
+		return err
+	}
+	return bw.Finish(r.Templates, req, status)
 }
 
 // Handler returns a http.HandlerFunc that renders the given template with the provided data.
@@ -57,3 +64,20 @@ func (r *Renderer) Handler(templateName string, data interface{}) http.HandlerFu
 func (r *Renderer) HandlerWithDataFromContext(templateName string, contextKey interface{}) http.HandlerFunc {
 	return r.HandlerRenderWithDataFromContext(templateName, contextKey)
 }
+
+// Wrap returns next wrapped with panic recovery into a themed error page, via
+// the embedded templates.Templates.Recoverer. It's named Wrap here to match
+// the net/http middleware-wrapping convention other stdlib-based routers use:
+//
+//	http.ListenAndServe(":8080", renderer.Wrap(mux))
+func (r *Renderer) Wrap(next http.Handler) http.Handler {
+	return r.Recoverer(next)
+}
+
+// HandleError renders a themed error page for err via
+// templates.Templates.RenderError, with status 500. Use it as a `func(w, r,
+// err)` error callback for handlers that follow that convention instead of
+// returning an error for the caller to check.
+func (r *Renderer) HandleError(w http.ResponseWriter, req *http.Request, err error) {
+	r.RenderError(w, req, http.StatusInternalServerError, err)
+}
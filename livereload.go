@@ -0,0 +1,249 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long watchLoop waits after the last file-change event
+// in a burst (e.g. an editor's save-via-rename writing several files) before
+// reparsing, instead of reparsing once per individual event.
+const watchDebounce = 100 * time.Millisecond
+
+// WatchAndReload watches LayoutsPath/PagesPath/BlocksPath -- recursively, so
+// a section-scoped layout or page in a subdirectory (see
+// resolveSectionLayout) is covered too -- on disk for changes to any
+// extension registered in TemplateFileExtensions and re-runs ParseTemplates
+// whenever one changes, notifying every client connected to
+// LiveReloadHandler, until ctx is canceled. It's a dev-mode alternative to
+// AlwaysReloadAndParseTemplates that reparses only on an actual file change
+// instead of on every request. A burst of changes (e.g. an editor's
+// save-via-rename touching several files) is coalesced into a single
+// reparse, fired watchDebounce after the last event in the burst. See
+// StartWatching for a version that manages its own context, stoppable via
+// Close.
+//
+// It only works against a real directory: Templates must have been built
+// via New(nil, ...). It returns an error immediately for a Templates backed
+// by an embed.FS, since embedded files can't change at runtime.
+//
+// A reparse that fails (e.g. a template file saved mid-edit with a syntax
+// error) leaves the previously parsed set in place, logs the error, calls
+// OnReloadError if set, and keeps watching -- it never takes down templates
+// already serving traffic. See ParseTemplates.
+func (t *Templates) WatchAndReload(ctx context.Context) error {
+	if t.fileSystemIsEmbed {
+		return errors.New("WatchAndReload: templates were loaded from an embed.FS, which can't change at runtime")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("WatchAndReload: creating watcher: %w", err)
+	}
+	for _, dir := range []string{t.LayoutsPath, t.PagesPath, t.BlocksPath} {
+		if err := addDirRecursive(watcher, filepath.Join(t.root, dir)); err != nil {
+			watcher.Close()
+			return fmt.Errorf("WatchAndReload: watching %s: %w", dir, err)
+		}
+	}
+	go t.watchLoop(ctx, watcher)
+	return nil
+}
+
+// addDirRecursive adds root and every subdirectory beneath it to watcher --
+// fsnotify watches a single directory, not a tree, so section-scoped
+// layouts/pages (layouts/blog, pages/blog, ...) each need their own Add.
+func addDirRecursive(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(p)
+		}
+		return nil
+	})
+}
+
+// StartWatching is WatchAndReload for callers that don't want to manage
+// their own context: it creates one internally, stored so Close can cancel
+// it, and starts the watcher goroutine against it. Calling it again replaces
+// the previous watcher's cancel func without stopping that watcher; call
+// Close between calls if that matters.
+func (t *Templates) StartWatching() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := t.WatchAndReload(ctx); err != nil {
+		cancel()
+		return err
+	}
+	t.watcherCancel = cancel
+	return nil
+}
+
+// Close stops the watcher goroutine started by StartWatching, if any. It is
+// a no-op if StartWatching was never called, or if WatchAndReload was used
+// directly instead (cancel its own context to stop that one).
+func (t *Templates) Close() error {
+	if t.watcherCancel != nil {
+		t.watcherCancel()
+		t.watcherCancel = nil
+	}
+	return nil
+}
+
+func (t *Templates) watchLoop(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	// trigger implements watchDebounce: each file-change event (re)arms
+	// timer instead of reparsing immediately, so a burst of saves (e.g. an
+	// editor's save-via-rename touching several files) collapses into one
+	// parse, fired watchDebounce after the last event in the burst.
+	var trigger string
+	timer := time.NewTimer(watchDebounce)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create) != 0 {
+				// A new section directory (e.g. "pages/blog" created after
+				// watching started) needs its own Add -- fsnotify doesn't
+				// watch a tree, only the directories it was explicitly given.
+				if info, statErr := os.Stat(event.Name); statErr == nil && info.IsDir() {
+					if err := addDirRecursive(watcher, event.Name); err != nil {
+						t.Logger.Error("WatchAndReload: watching new directory", "dir", event.Name, "error", err)
+					}
+				}
+			}
+			if _, known := t.TemplateFileExtensions[path.Ext(event.Name)]; !known {
+				continue
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(watchDebounce)
+			trigger = event.Name
+		case <-timer.C:
+			// ParseTemplates builds the new set into a local map and swaps
+			// it into t.current atomically, so a parse error here -- a
+			// corrupted template file -- never takes down the set already
+			// serving traffic, and an in-flight render never sees a
+			// half-built one either.
+			err := t.ParseTemplates()
+			if err != nil {
+				t.Logger.Error("WatchAndReload: reparsing templates", "error", err)
+				if t.OnReloadError != nil {
+					t.OnReloadError(err)
+				}
+				continue
+			}
+			t.Logger.Info("WatchAndReload: reparsed templates", "trigger", trigger)
+			t.liveReload().broadcast()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			t.Logger.Error("WatchAndReload: watcher error", "error", err)
+		}
+	}
+}
+
+// liveReloadHub fans a reload signal out to every client connected to
+// LiveReloadHandler.
+type liveReloadHub struct {
+	mu   sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+func (t *Templates) liveReload() *liveReloadHub {
+	t.liveReloadOnce.Do(func() {
+		t.liveReloadHub = &liveReloadHub{subs: map[chan struct{}]struct{}{}}
+	})
+	return t.liveReloadHub
+}
+
+func (h *liveReloadHub) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *liveReloadHub) unsubscribe(ch chan struct{}) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+	close(ch)
+}
+
+func (h *liveReloadHub) broadcast() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// LiveReloadHandler serves a Server-Sent Events stream that emits a "reload"
+// event every time WatchAndReload re-parses the templates, until the client
+// disconnects. Mount it at a fixed path (e.g. "/__livereload") and pair it
+// with LiveReloadScript, injected into dev-mode HTML pages, to have the
+// browser auto-refresh whenever a template file changes.
+func (t *Templates) LiveReloadHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := t.liveReload().subscribe()
+	defer t.liveReload().unsubscribe(ch)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+			fmt.Fprint(w, "event: reload\ndata: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// LiveReloadScript is a small <script> snippet that opens an EventSource to
+// path (the path LiveReloadHandler is mounted at) and reloads the page on
+// the next "reload" event. Append it to an HTML response, e.g. just before
+// "</body>", only in development, alongside WatchAndReload.
+func LiveReloadScript(path string) string {
+	return fmt.Sprintf(`<script>new EventSource(%q).addEventListener("reload", function(){ location.reload(); });</script>`, path)
+}
@@ -0,0 +1,165 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newWatchedFixture builds a files/templates tree under a temp dir and
+// chdir's into it (WatchAndReload, like New(nil, ...), resolves paths
+// relative to the working directory), returning the Templates instance and
+// the page file's path to edit.
+func newWatchedFixture(t *testing.T) (tmpls *Templates, pagePath string) {
+	dir, err := ioutil.TempDir("", "watch_reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	layoutDir := filepath.Join(dir, "files/templates/layouts")
+	pageDir := filepath.Join(dir, "files/templates/pages")
+	blockDir := filepath.Join(dir, "files/templates/blocks")
+	os.MkdirAll(layoutDir, 0755)
+	os.MkdirAll(pageDir, 0755)
+	os.MkdirAll(blockDir, 0755)
+
+	pagePath = filepath.Join(pageDir, "watched.gohtml")
+	if err := ioutil.WriteFile(filepath.Join(layoutDir, "application.gohtml"), []byte(`{{define "layout"}}{{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pagePath, []byte(`{{define "page"}}v1{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls = New(nil, nil)
+	tmpls.MustParseTemplates()
+	return tmpls, pagePath
+}
+
+// waitFor polls cond every 10ms until it returns true or timeout elapses,
+// returning whether it ever did.
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cond()
+}
+
+func Test_WatchAndReload_PicksUpChange(t *testing.T) {
+	tmpls, pagePath := newWatchedFixture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := tmpls.WatchAndReload(ctx); err != nil {
+		t.Fatalf("WatchAndReload: %v", err)
+	}
+
+	if err := ioutil.WriteFile(pagePath, []byte(`{{define "page"}}v2{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := waitFor(2*time.Second, func() bool {
+		res, err := tmpls.ExecuteTemplateAsText(nil, "watched", nil)
+		return err == nil && res == "v2"
+	})
+	if !ok {
+		res, err := tmpls.ExecuteTemplateAsText(nil, "watched", nil)
+		t.Fatalf("expected the watcher to pick up the file change and serve %q, got %q (err=%v)", "v2", res, err)
+	}
+}
+
+func Test_WatchAndReload_KeepsServingOldSetOnParseError(t *testing.T) {
+	tmpls, pagePath := newWatchedFixture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := tmpls.WatchAndReload(ctx); err != nil {
+		t.Fatalf("WatchAndReload: %v", err)
+	}
+
+	if err := ioutil.WriteFile(pagePath, []byte(`{{define "page"}}{{if}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Give the watcher time to notice and attempt (and fail) a reparse.
+	time.Sleep(500 * time.Millisecond)
+
+	res, err := tmpls.ExecuteTemplateAsText(nil, "watched", nil)
+	if err != nil {
+		t.Fatalf("expected the previously parsed template to still render after a failed reload, got error: %v", err)
+	}
+	if res != "v1" {
+		t.Errorf("expected the pre-corruption content %q to still be served, got %q", "v1", res)
+	}
+}
+
+// Test_WatchAndReload_ConcurrentReads is Test_Concurrency for the
+// WatchAndReload path: it hammers ExecuteTemplateAsText from many goroutines
+// while a background goroutine repeatedly rewrites the watched page, proving
+// readers never block on (or race with) the reload swap. Run with -race to
+// check the second half of that claim.
+func Test_WatchAndReload_ConcurrentReads(t *testing.T) {
+	tmpls, pagePath := newWatchedFixture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := tmpls.WatchAndReload(ctx); err != nil {
+		t.Fatalf("WatchAndReload: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				content := []byte(fmt.Sprintf(`{{define "page"}}v%d{{end}}`, i))
+				ioutil.WriteFile(pagePath, content, 0644)
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					tmpls.ExecuteTemplateAsText(nil, "watched", nil) // result doesn't matter here, only that it never races or panics
+				}
+			}
+		}()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	close(done)
+	wg.Wait()
+}
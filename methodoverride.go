@@ -0,0 +1,30 @@
+package templates
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultMethodOverrideField is the form field name MethodOverride reads
+// when an app doesn't pick its own, matching Rails' "_method" convention for
+// an HTML form, which can only submit as GET or POST.
+const DefaultMethodOverrideField = "_method"
+
+// MethodOverride returns net/http middleware that rewrites a POST request's
+// r.Method to the value of its formField form field, when present -- e.g.
+// turning a `<form method="post"><input type="hidden" name="_method"
+// value="DELETE">` submission into a DELETE request before it reaches a
+// router that dispatches on method (chi, gin, echo all do). It is a no-op
+// for any method other than POST, and for a POST with no such field.
+func MethodOverride(formField string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				if override := r.FormValue(formField); override != "" {
+					r.Method = strings.ToUpper(override)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
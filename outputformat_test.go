@@ -0,0 +1,44 @@
+package templates
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_HandlerRenderWithDataForFormat(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "handler_for_format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layoutsDir := filepath.Join(tmpDir, "layouts")
+	pagesDir := filepath.Join(tmpDir, "pages")
+	os.MkdirAll(layoutsDir, 0755)
+	os.MkdirAll(pagesDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutsDir, "application.gohtml"), []byte(`{{define "layout"}}html: {{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "product.gohtml"), []byte(`{{define "page"}}{{.Name}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+
+	handler := tmpls.HandlerRenderWithDataForFormat("product", "json", map[string]string{"Name": "Widget"})
+	req := httptest.NewRequest("GET", "/product", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if want := "application/json"; w.Header().Get("Content-Type") != want {
+		t.Errorf("expected Content-Type %q, got %q", want, w.Header().Get("Content-Type"))
+	}
+	if want := `{"Name":"Widget"}`; w.Body.String() != want {
+		t.Errorf("expected forced json format output %q, got %q", want, w.Body.String())
+	}
+}
@@ -0,0 +1,193 @@
+package templates
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseErrorKind classifies why ParseTemplates failed, for callers that
+// want to do more than print Error() -- e.g. a dev-mode error page that
+// picks a message or an icon per Kind. See ParseError.
+type ParseErrorKind int
+
+const (
+	// ParseErrorUnknown is a ParseTemplates failure that didn't match any
+	// of the other Kinds; Err still carries the underlying cause.
+	ParseErrorUnknown ParseErrorKind = iota
+	// ParseErrorMissingLayouts is "you need at least one layout": the
+	// layouts directory read without error but contained zero files.
+	ParseErrorMissingLayouts
+	// ParseErrorBlockNameMismatch is a blocks/ file whose {{define}} name
+	// doesn't match its filename (see ParseTemplates).
+	ParseErrorBlockNameMismatch
+	// ParseErrorDuplicateBlock is two blocks/ files defining the same
+	// block name.
+	ParseErrorDuplicateBlock
+	// ParseErrorSyntax is a Go template syntax error from the underlying
+	// html/template or text/template parser.
+	ParseErrorSyntax
+	// ParseErrorIO is a filesystem error reading a layout/page/block file
+	// or directory, e.g. a missing templates root.
+	ParseErrorIO
+)
+
+// String renders k the way FormatParseError's report tags it, e.g.
+// "BlockNameMismatch".
+func (k ParseErrorKind) String() string {
+	switch k {
+	case ParseErrorMissingLayouts:
+		return "MissingLayouts"
+	case ParseErrorBlockNameMismatch:
+		return "BlockNameMismatch"
+	case ParseErrorDuplicateBlock:
+		return "DuplicateBlock"
+	case ParseErrorSyntax:
+		return "ParseSyntax"
+	case ParseErrorIO:
+		return "IO"
+	default:
+		return "Unknown"
+	}
+}
+
+// ParseError is the error ParseTemplates returns on failure. It carries
+// enough context -- Kind, File, Line, Column and a Snippet of surrounding
+// source -- to render a dev-mode error page instead of a bare Go error
+// string; use errors.As to recover it. Error() still renders a string
+// compatible with callers written against plain error messages (the ones
+// TestParseTemplatesErrors matched on before ParseError existed): File and
+// Line are only prefixed when known, so e.g. ParseErrorMissingLayouts,
+// which has neither, renders identically to the old "you need at least one
+// layout".
+type ParseError struct {
+	Kind    ParseErrorKind
+	File    string
+	Line    int
+	Column  int
+	Snippet string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return e.Err.Error()
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err.Error())
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Err.Error())
+}
+
+// Unwrap exposes Err to errors.Is/errors.As, e.g. for a caller matching on
+// a sentinel wrapped further down by a filesystem package.
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// newParseError builds a ParseError for file, reading the Snippet around
+// line when both are known. Reading the snippet is best effort: a failure
+// to open file just leaves Snippet empty, since the original err is more
+// useful to report than its source context.
+func newParseError(kind ParseErrorKind, file string, line, column int, err error) *ParseError {
+	pe := &ParseError{Kind: kind, File: file, Line: line, Column: column, Err: err}
+	if file != "" && line > 0 {
+		pe.Snippet = readSnippet(file, line)
+	}
+	return pe
+}
+
+// snippetRadius is how many lines of source FormatParseError shows above
+// and below the offending line.
+const snippetRadius = 3
+
+// readSnippet returns the lines within snippetRadius of line in file,
+// each prefixed with its line number and a "-> " marker on line itself, or
+// "" if file can't be read.
+func readSnippet(file string, line int) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	start, end := line-snippetRadius, line+snippetRadius
+	var b strings.Builder
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan() && n <= end; n++ {
+		if n < start {
+			continue
+		}
+		marker := "   "
+		if n == line {
+			marker = "-> "
+		}
+		fmt.Fprintf(&b, "%s%4d| %s\n", marker, n, scanner.Text())
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// templateErrorPosRe recovers the position html/template and text/template
+// format into their error strings, e.g. `template: page:12:5: unexpected
+// "}}" in operand` -- neither package exposes it any more directly than
+// that; see parseSyntaxError.
+var templateErrorPosRe = regexp.MustCompile(`template:\s*([^:]+):(\d+)(?::(\d+))?:`)
+
+// parseSyntaxError turns a raw error from Engine.ParseFiles into a
+// ParseErrorSyntax ParseError, recovering File/Line/Column from the
+// underlying parser's error string. Falls back to ParseErrorUnknown with no
+// position if the message doesn't match the expected shape, e.g. a wrapped
+// non-syntax error (a missing file ParseFS itself reports, say).
+func parseSyntaxError(path string, err error) *ParseError {
+	m := templateErrorPosRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return newParseError(ParseErrorUnknown, path, 0, 0, err)
+	}
+	line, _ := strconv.Atoi(m[2])
+	column, _ := strconv.Atoi(m[3]) // m[3] == "" parses as 0, which is what we want
+	return newParseError(ParseErrorSyntax, path, line, column, err)
+}
+
+// classifyParseFilesError turns a raw error from Engine.ParseFiles into a
+// ParseError: ParseErrorIO if it's a missing file (ParseFS reading a page,
+// layout or block that's since been deleted -- a reload race, mainly), else
+// ParseErrorSyntax/ParseErrorUnknown via parseSyntaxError.
+func classifyParseFilesError(path string, err error) *ParseError {
+	if errors.Is(err, fs.ErrNotExist) {
+		return newParseError(ParseErrorIO, path, 0, 0, err)
+	}
+	return parseSyntaxError(path, err)
+}
+
+// FormatParseError renders err as a human-friendly report suitable for a
+// dev-mode error page: the file (and line:column, when known) in bold
+// markdown, the message, and a source Snippet with a caret under the
+// offending column. Falls back to err.Error() if err isn't a *ParseError.
+func FormatParseError(err error) string {
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		return err.Error()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s", pe.File)
+	if pe.Line > 0 {
+		fmt.Fprintf(&b, ":%d", pe.Line)
+		if pe.Column > 0 {
+			fmt.Fprintf(&b, ":%d", pe.Column)
+		}
+	}
+	fmt.Fprintf(&b, "** [%s]\n%s\n", pe.Kind, pe.Err.Error())
+
+	if pe.Snippet != "" {
+		b.WriteString(pe.Snippet)
+		b.WriteString("\n")
+		if pe.Column > 0 {
+			fmt.Fprintf(&b, "%s^\n", strings.Repeat(" ", len("-> ")+len(fmt.Sprintf("%4d| ", pe.Line))+pe.Column-1))
+		}
+	}
+	return b.String()
+}
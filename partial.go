@@ -0,0 +1,80 @@
+package templates
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/google/safehtml"
+)
+
+// partial renders the named block via RenderBlockAsHTMLString -- which
+// already enforces the "_" prefix and 255-char limit -- for the 'partial'
+// FuncMap helper. It's d_block under a Hugo-familiar name; see
+// AddPartialFuncMapHelpers.
+func (t *Templates) partial(blockname string, payload interface{}) (safehtml.HTML, error) {
+	return t.RenderBlockAsHTMLString(blockname, payload)
+}
+
+// partialCached is the 'partialCached' FuncMap helper: RenderBlockAsHTMLString,
+// memoized in t.partialCache for the lifetime of the process (or until the
+// next ParseTemplates, which clears it along with t.Cache -- see
+// WatchAndReload). discriminators are stringified with fmt.Sprint and hashed
+// with fnv64 to form the cache key alongside blockname, so
+//
+//	{{ partialCached "_nav" . .Section }}
+//
+// renders "_nav" once per distinct .Section value and serves the memoized
+// safehtml.HTML on every later call with that same value, however often the
+// page is rendered. Unlike RenderBlockAsHTMLStringCached/d_block_cached,
+// there's no ttl: a partialCached entry lives until the next reparse, which
+// is the right tradeoff for a fragment that only changes when its own
+// template (or the data it closes over) does, not on a clock.
+func (t *Templates) partialCached(blockname string, payload interface{}, discriminators ...interface{}) (safehtml.HTML, error) {
+	if !isValidBlockname(blockname) {
+		return t.RenderBlockAsHTMLString(blockname, payload) // let it report the real error
+	}
+	key := blockname + "|" + discriminatorHash(discriminators)
+	if cached, ok := t.partialCache.Load(key); ok {
+		return cached.(safehtml.HTML), nil
+	}
+	html, err := t.RenderBlockAsHTMLString(blockname, payload)
+	if err != nil {
+		return html, err
+	}
+	t.partialCache.Store(key, html)
+	return html, nil
+}
+
+func isValidBlockname(blockname string) bool {
+	return len(blockname) > 0 && len(blockname) <= 255 && blockname[0] == '_'
+}
+
+// discriminatorHash hashes the string form of discriminators with fnv64,
+// giving partialCached a fixed-width key component regardless of how many
+// discriminators are passed or how large they are.
+func discriminatorHash(discriminators []interface{}) string {
+	h := fnv.New64a()
+	fmt.Fprint(h, discriminators...)
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// AddPartialFuncMapHelpers adds the 'partial' and 'partialCached' functions
+// to the FuncMap, Hugo's partial/partialCached pattern built on the existing
+// RenderBlockAsHTMLString/d_block path:
+//
+//	{{ partial "_sidebar" . }}
+//	{{ partialCached "_nav" . .Section }}
+//
+// partialCached memoizes per distinct set of discriminators (variadic,
+// compared by their string form) in t.partialCache, cleared on the next
+// ParseTemplates.
+func (t *Templates) AddPartialFuncMapHelpers() {
+	for _, name := range []string{"partial", "partialCached"} {
+		if _, ok := t.funcMap[name]; ok {
+			t.Logger.Error("function name is already in use in FuncMap", "name", name)
+			panic("function name '" + name + "' is already in use in FuncMap")
+		}
+	}
+	t.funcMap["partial"] = t.partial
+	t.funcMap["partialCached"] = t.partialCached
+}
@@ -0,0 +1,138 @@
+package templates
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/safehtml/template"
+)
+
+// newPartialFixture builds a minimal files/templates tree with one block,
+// "_counted", that calls a counter func on every execution -- so tests can
+// tell a cache hit (counter doesn't advance) from a re-render (it does.)
+func newPartialFixture(t *testing.T) (tmpls *Templates, calls *int64) {
+	dir, err := ioutil.TempDir("", "partial_fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	layoutDir := filepath.Join(dir, "files/templates/layouts")
+	pageDir := filepath.Join(dir, "files/templates/pages")
+	blockDir := filepath.Join(dir, "files/templates/blocks")
+	os.MkdirAll(layoutDir, 0755)
+	os.MkdirAll(pageDir, 0755)
+	os.MkdirAll(blockDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutDir, "application.gohtml"), []byte(`{{define "layout"}}{{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pageDir, "home.gohtml"), []byte(`{{define "page"}}page{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(blockDir, "_counted.gohtml"), []byte(`{{define "_counted"}}count:{{count}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	calls = new(int64)
+	tmpls = New(nil, template.FuncMap{
+		"count": func() int64 { return atomic.AddInt64(calls, 1) },
+	})
+	tmpls.MustParseTemplates()
+	return tmpls, calls
+}
+
+func Test_partialCached(t *testing.T) {
+	tmpls, calls := newPartialFixture(t)
+
+	first, err := tmpls.partialCached("_counted", nil)
+	if err != nil {
+		t.Fatalf("first render: %v", err)
+	}
+	if first.String() != "count:1" {
+		t.Fatalf("expected the block to render on first call, got %q", first.String())
+	}
+
+	second, err := tmpls.partialCached("_counted", nil)
+	if err != nil {
+		t.Fatalf("second render: %v", err)
+	}
+	if second.String() != first.String() {
+		t.Errorf("expected the cached render %q, got %q", first.String(), second.String())
+	}
+	if got := atomic.LoadInt64(calls); got != 1 {
+		t.Errorf("expected the block to execute exactly once, got %d executions", got)
+	}
+}
+
+func Test_partialCached_DistinctDiscriminators(t *testing.T) {
+	tmpls, calls := newPartialFixture(t)
+
+	if _, err := tmpls.partialCached("_counted", nil, "en"); err != nil {
+		t.Fatalf("render for \"en\": %v", err)
+	}
+	if _, err := tmpls.partialCached("_counted", nil, "de"); err != nil {
+		t.Fatalf("render for \"de\": %v", err)
+	}
+	if _, err := tmpls.partialCached("_counted", nil, "en"); err != nil {
+		t.Fatalf("second render for \"en\": %v", err)
+	}
+
+	if got := atomic.LoadInt64(calls); got != 2 {
+		t.Errorf("expected one execution per distinct discriminator (2 total), got %d", got)
+	}
+}
+
+func Test_partialCached_ClearedOnReparse(t *testing.T) {
+	tmpls, calls := newPartialFixture(t)
+
+	if _, err := tmpls.partialCached("_counted", nil); err != nil {
+		t.Fatalf("first render: %v", err)
+	}
+	if err := tmpls.ParseTemplates(); err != nil {
+		t.Fatalf("ParseTemplates: %v", err)
+	}
+	if _, err := tmpls.partialCached("_counted", nil); err != nil {
+		t.Fatalf("render after reparse: %v", err)
+	}
+
+	if got := atomic.LoadInt64(calls); got != 2 {
+		t.Errorf("expected ParseTemplates to clear partialCache, forcing a re-render (2 executions), got %d", got)
+	}
+}
+
+func Test_partial(t *testing.T) {
+	tmpls, _ := newPartialFixture(t)
+
+	res, err := tmpls.partial("_counted", nil)
+	if err != nil {
+		t.Fatalf("partial: %v", err)
+	}
+	if res.String() != "count:1" {
+		t.Errorf("expected %q, got %q", "count:1", res.String())
+	}
+}
+
+func Test_discriminatorHash(t *testing.T) {
+	if discriminatorHash([]interface{}{"a", 1}) == discriminatorHash([]interface{}{"b", 1}) {
+		t.Error("expected different discriminators to hash differently")
+	}
+	if discriminatorHash([]interface{}{"same"}) != discriminatorHash([]interface{}{"same"}) {
+		t.Error("expected identical discriminators to hash identically")
+	}
+	if discriminatorHash(nil) == "" {
+		t.Error("expected a non-empty hash even with no discriminators")
+	}
+}
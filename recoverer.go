@@ -0,0 +1,38 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// StackTraceContextKey is the key under which Recoverer stores a recovered
+// panic's stack trace, for RenderError to surface to an error template as
+// "StackTrace".
+type StackTraceContextKey struct{}
+
+// Recoverer returns net/http middleware that recovers a panic from the rest
+// of the handler chain and renders it as a themed error page via
+// RenderError, instead of leaving the connection half-written or falling
+// back to net/http's default "plain text + close the connection" recovery.
+// The recovered stack trace is made available to RenderError via
+// StackTraceContextKey. Suitable for chi and chirender, which are both
+// net/http-compatible; see integrations/echo for an Echo-native equivalent.
+func (t *Templates) Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			err, ok := rec.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rec)
+			}
+			ctx := context.WithValue(r.Context(), StackTraceContextKey{}, string(debug.Stack()))
+			t.RenderError(w, r.WithContext(ctx), http.StatusInternalServerError, err)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,117 @@
+package templates
+
+import (
+	"bytes"
+	"net/http"
+	"runtime"
+	"strconv"
+)
+
+// RegisterContextProvider registers fn under name: ExecuteTemplate calls
+// every registered provider for the current request and merges the results
+// into a TemplateContext, so sub-templates (e.g. the _header, _user_card,
+// _trusted_content blocks a CMS page assembles from API data) can reach
+// per-request values like a locale, the CSRF token or the signed-in user
+// without them being threaded through every block's own data:
+//
+//	tmpls.RegisterContextProvider("Locale", func(r *http.Request) any { return resolveLocale(r) })
+//	tmpls.RegisterContextProvider("CSRFToken", func(r *http.Request) any { return csrfToken(r) })
+//	tmpls.RegisterContextProvider("User", func(r *http.Request) any { return currentUser(r) })
+//	tmpls.RegisterContextProvider("RequestID", func(r *http.Request) any { return middleware.GetReqID(r.Context()) })
+//
+// When a page or block's own data is a map[string]interface{}, ExecuteTemplate
+// injects the built TemplateContext under the key "ctx" automatically (a
+// copy of the map -- the caller's own map is never mutated), so a template
+// reads it as `{{ctx.Locale.Tr "greeting"}} {{ctx.CSRFToken}} {{ctx.User}}`.
+// Typed struct data (the common case for a page like Person{}) has no spare
+// field to inject into; the same TemplateContext is reached there instead
+// by calling the "ctx" function this also registers in the FuncMap --
+// `{{ctx.User}}`, or `{{$ctx := ctx}}` once per template and `{{$ctx.User}}`
+// after that.
+//
+// Locale, CSRFToken, User and RequestID are TemplateContext's named
+// accessors; Get resolves any other provider name.
+func (t *Templates) RegisterContextProvider(name string, fn func(r *http.Request) any) {
+	if t.contextProviders == nil {
+		t.contextProviders = map[string]func(*http.Request) any{}
+	}
+	t.contextProviders[name] = fn
+
+	if _, ok := t.dynamicFuncs["ctx"]; !ok {
+		t.RegisterDynamicFunc("ctx", func(r *http.Request) any {
+			return t.buildContext(r)
+		})
+	}
+}
+
+// buildContext evaluates every registered context provider for r into a
+// fresh TemplateContext, owned (see DataRaceCheck) by the calling goroutine.
+func (t *Templates) buildContext(r *http.Request) TemplateContext {
+	values := make(map[string]interface{}, len(t.contextProviders))
+	for name, fn := range t.contextProviders {
+		values[name] = fn(r)
+	}
+	return TemplateContext{
+		checked: t.DataRaceCheck,
+		owner:   currentGoroutineID(),
+		values:  values,
+	}
+}
+
+// TemplateContext is what RegisterContextProvider's "ctx" function (and the
+// "ctx" key ExecuteTemplate injects into map-typed page data) resolves to:
+// every provider's value for the current request, by name. Locale,
+// CSRFToken, User and RequestID are convenience accessors for that many
+// common provider names; Get resolves any other registered name.
+type TemplateContext struct {
+	checked bool
+	owner   uint64
+	values  map[string]interface{}
+}
+
+// checkOwner panics if Templates.DataRaceCheck is on and c is being read
+// from a goroutine other than the one ExecuteTemplate built it on -- e.g. a
+// handler stashed c (or a value reached through it) and read it later from
+// a goroutine it spawned, without whatever synchronization that requires.
+// Every accessor below calls this first, since it's the only hook Go's
+// template engine gives a value it renders: a reflection-invoked method
+// call, unlike a plain map's field lookup, runs real Go code on each access.
+func (c TemplateContext) checkOwner() {
+	if c.checked && currentGoroutineID() != c.owner {
+		panic("templates: TemplateContext accessed from a different goroutine than the one that built it (DataRaceCheck)")
+	}
+}
+
+// Get returns the value the provider registered under name returned for
+// this request, or nil if no such provider is registered.
+func (c TemplateContext) Get(name string) any {
+	c.checkOwner()
+	return c.values[name]
+}
+
+// Locale returns the "Locale" provider's value.
+func (c TemplateContext) Locale() any { return c.Get("Locale") }
+
+// CSRFToken returns the "CSRFToken" provider's value.
+func (c TemplateContext) CSRFToken() any { return c.Get("CSRFToken") }
+
+// User returns the "User" provider's value.
+func (c TemplateContext) User() any { return c.Get("User") }
+
+// RequestID returns the "RequestID" provider's value.
+func (c TemplateContext) RequestID() any { return c.Get("RequestID") }
+
+// currentGoroutineID parses the current goroutine's id out of its own stack
+// trace header ("goroutine 123 [running]:"), the technique several
+// community race-detection/goroutine-local-storage packages use since the
+// runtime exposes no public API for it.
+func currentGoroutineID() uint64 {
+	buf := make([]byte, 64)
+	n := runtime.Stack(buf, false)
+	buf = bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if end := bytes.IndexByte(buf, ' '); end >= 0 {
+		buf = buf[:end]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
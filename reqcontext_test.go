@@ -0,0 +1,109 @@
+package templates
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func newContextFixture(t testing.TB) *Templates {
+	tmpDir, err := ioutil.TempDir("", "reqcontext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	layoutsDir := filepath.Join(tmpDir, "layouts")
+	pagesDir := filepath.Join(tmpDir, "pages")
+	os.MkdirAll(layoutsDir, 0755)
+	os.MkdirAll(pagesDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutsDir, "default.gohtml"), []byte(`{{define "layout"}}{{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "home.gohtml"), []byte(`{{define "page"}}{{.Name}} says {{ctx.Locale}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "mapdata.gohtml"), []byte(`{{define "page"}}{{.Name}} says {{.ctx.Locale}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	return tmpls
+}
+
+func Test_RegisterContextProvider(t *testing.T) {
+	tmpls := newContextFixture(t)
+	tmpls.RegisterContextProvider("Locale", func(r *http.Request) any {
+		return r.Header.Get("X-Locale")
+	})
+	tmpls.MustParseTemplates()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Locale", "de")
+
+	t.Run("struct data via the ctx function", func(t *testing.T) {
+		res, err := tmpls.ExecuteTemplateAsText(r, "home", struct{ Name string }{Name: "Greta"})
+		failOnErr(t, err)
+		if want := "Greta says de"; res != want {
+			t.Errorf("expected %q, got %q", want, res)
+		}
+	})
+
+	t.Run("map data auto-injected under ctx", func(t *testing.T) {
+		res, err := tmpls.ExecuteTemplateAsText(r, "mapdata", map[string]interface{}{"Name": "Greta"})
+		failOnErr(t, err)
+		if want := "Greta says de"; res != want {
+			t.Errorf("expected %q, got %q", want, res)
+		}
+	})
+}
+
+func Test_TemplateContext_Get(t *testing.T) {
+	tmpls := New(nil, nil)
+	tmpls.RegisterContextProvider("User", func(r *http.Request) any { return "alice" })
+	tmpls.RegisterContextProvider("RequestID", func(r *http.Request) any { return "req-1" })
+
+	r := httptest.NewRequest("GET", "/", nil)
+	ctx := tmpls.buildContext(r)
+
+	if got := ctx.User(); got != "alice" {
+		t.Errorf("expected User() to return %q, got %v", "alice", got)
+	}
+	if got := ctx.RequestID(); got != "req-1" {
+		t.Errorf("expected RequestID() to return %q, got %v", "req-1", got)
+	}
+	if got := ctx.Get("Missing"); got != nil {
+		t.Errorf("expected Get of an unregistered name to return nil, got %v", got)
+	}
+}
+
+func Test_TemplateContext_DataRaceCheck(t *testing.T) {
+	tmpls := New(nil, nil)
+	tmpls.DataRaceCheck = true
+	tmpls.RegisterContextProvider("Locale", func(r *http.Request) any { return "en" })
+
+	r := httptest.NewRequest("GET", "/", nil)
+	ctx := tmpls.buildContext(r)
+
+	if got := ctx.Locale(); got != "en" {
+		t.Errorf("expected Locale() to return %q on the owning goroutine, got %v", "en", got)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			if recover() == nil {
+				t.Error("expected Locale() to panic when read from a different goroutine")
+			}
+		}()
+		ctx.Locale()
+	}()
+	wg.Wait()
+}
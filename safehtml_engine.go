@@ -0,0 +1,124 @@
+package templates
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"text/template/parse"
+
+	"github.com/google/safehtml/template"
+)
+
+// SafehtmlEngine is the default Engine. It parses ".gohtml" files with
+// google/safehtml/template, which applies context-aware auto-escaping and is
+// the reason this package is safe against XSS by default.
+type SafehtmlEngine struct {
+	fs template.TrustedFS
+
+	overlay     template.TrustedFS
+	overlayStat fs.FS // see SetOverlay; used only to check whether overlay has a file, since TrustedFS exposes no Open/Stat of its own
+	hasOverlay  bool
+}
+
+// NewSafehtmlEngine constructs a SafehtmlEngine that reads template files
+// from the given trusted filesystem.
+func NewSafehtmlEngine(fs template.TrustedFS) *SafehtmlEngine {
+	return &SafehtmlEngine{fs: fs}
+}
+
+// SetOverlay makes ParseFiles prefer overlay over the base filesystem for
+// any file overlayStat has at the same path -- overlayStat and overlay must
+// be two views of the same filesystem, the former a plain fs.FS usable with
+// fs.Stat, the latter its TrustedFS counterpart usable with ParseFS. See
+// Templates.AddOverlay, the only caller.
+func (e *SafehtmlEngine) SetOverlay(overlay template.TrustedFS, overlayStat fs.FS) {
+	e.overlay = overlay
+	e.overlayStat = overlayStat
+	e.hasOverlay = true
+}
+
+// ParseFiles implements Engine.
+func (e *SafehtmlEngine) ParseFiles(fnMap map[string]any, files ...string) (ParsedTemplate, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files in slice")
+	}
+	t := template.New("").Funcs(template.FuncMap(fnMap))
+
+	baseFiles, overlayFiles := files, []string(nil)
+	if e.hasOverlay {
+		baseFiles, overlayFiles = nil, nil
+		for _, f := range files {
+			if _, err := fs.Stat(e.overlayStat, f); err == nil {
+				overlayFiles = append(overlayFiles, f)
+			} else {
+				baseFiles = append(baseFiles, f)
+			}
+		}
+	}
+
+	var err error
+	if len(baseFiles) > 0 {
+		if t, err = t.ParseFS(e.fs, baseFiles...); err != nil {
+			return nil, err
+		}
+	}
+	if len(overlayFiles) > 0 {
+		if t, err = t.ParseFS(e.overlay, overlayFiles...); err != nil {
+			return nil, err
+		}
+	}
+	return &safehtmlParsedTemplate{t: t}, nil
+}
+
+// safehtmlParsedTemplate adapts *safehtml/template.Template to ParsedTemplate.
+type safehtmlParsedTemplate struct {
+	t *template.Template
+}
+
+func (p *safehtmlParsedTemplate) ExecuteTemplate(w io.Writer, name string, data any) error {
+	return p.t.ExecuteTemplate(w, name, data)
+}
+
+func (p *safehtmlParsedTemplate) DefinedTemplates() []string {
+	var names []string
+	for _, tmpl := range p.t.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root.Pos == 0 {
+			continue
+		}
+		names = append(names, tmpl.Name())
+	}
+	return names
+}
+
+// Clone implements dynamicFuncPatcher, for RegisterDynamicFunc's pool of
+// per-execution clones.
+func (p *safehtmlParsedTemplate) Clone() (ParsedTemplate, error) {
+	t, err := p.t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &safehtmlParsedTemplate{t: t}, nil
+}
+
+// Funcs implements dynamicFuncPatcher, merging fnMap into this clone's
+// function map in place. Safe only because RegisterDynamicFunc's pool
+// guarantees exclusive ownership of the clone for the duration of one
+// execution.
+func (p *safehtmlParsedTemplate) Funcs(fnMap map[string]any) error {
+	p.t.Funcs(template.FuncMap(fnMap))
+	return nil
+}
+
+// Trees exposes the parse trees of every named template in this set, keyed
+// by name. It is used by CheckTemplate's static type checking, which only
+// supports engines -- like this one -- that expose their parse.Tree.
+func (p *safehtmlParsedTemplate) Trees() map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree, len(p.t.Templates()))
+	for _, tmpl := range p.t.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		trees[tmpl.Name()] = tmpl.Tree
+	}
+	return trees
+}
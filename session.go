@@ -0,0 +1,73 @@
+package templates
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// SessionStore is the pluggable backend EnableCSRF and FlashMiddleware use to
+// read and write small per-visitor string values (a CSRF token, a flash
+// message) across requests. Implement it over whatever session mechanism an
+// app already has (gorilla/sessions, a signed-cookie library, a server-side
+// store keyed by a session-id cookie); CookieSessionStore is a minimal
+// default for an app that doesn't have one yet.
+type SessionStore interface {
+	// Get returns the value stored under key for r's session, if any.
+	Get(r *http.Request, key string) (value string, ok bool)
+
+	// Set stores value under key for r's session, persisting it via w (e.g.
+	// as a cookie, or a cookie-keyed server-side record).
+	Set(w http.ResponseWriter, r *http.Request, key, value string)
+
+	// Delete removes key from r's session.
+	Delete(w http.ResponseWriter, r *http.Request, key string)
+}
+
+// CookieSessionStore is a minimal SessionStore that stores each key directly
+// as its own cookie, url-encoded and unsigned. It gets CSRF protection and
+// flash messages working with zero setup; for anything holding more than a
+// throwaway token or a one-shot message, supply a SessionStore backed by a
+// real session library instead.
+type CookieSessionStore struct {
+	// Secure sets the Secure attribute on cookies this store writes. Leave
+	// false for local HTTP development; set true once requests arrive over
+	// HTTPS.
+	Secure bool
+}
+
+func (s CookieSessionStore) Get(r *http.Request, key string) (string, bool) {
+	cookie, err := r.Cookie(key)
+	if err != nil {
+		return "", false
+	}
+	value, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+func (s CookieSessionStore) Set(w http.ResponseWriter, r *http.Request, key, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     key,
+		Value:    url.QueryEscape(value),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.Secure,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Now().Add(24 * time.Hour),
+	})
+}
+
+func (s CookieSessionStore) Delete(w http.ResponseWriter, r *http.Request, key string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     key,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
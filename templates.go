@@ -15,17 +15,142 @@
 // Using safehtml/template ensures that your output is free from XSS vulnerabilities by default.
 // Context-aware escaping is applied automatically. For cases where you strictly trust the input
 // (e.g. from a CMS), special helper functions `trusted_*` are provided.
+//
+// # Output Formats
+//
+// A page can be rendered in more than one format (HTML, JSON, RSS, AMP, ...)
+// without duplicating routes. Register formats on Templates.OutputFormats,
+// add a "<page>.<suffix>.gohtml" variant alongside the plain page file, and
+// ExecuteTemplate will pick the right variant for the request. A format with
+// no sensible template representation (e.g. the built-in "json" format) can
+// set OutputFormat.Serializer instead, to marshal data directly and skip
+// template lookup entirely. See OutputFormat and ResolveOutputFormat. Call
+// ExecuteFormat instead to render a specific format regardless of what the
+// request negotiates to. RenderAtomFeed/RenderSitemap build an Atom feed or
+// sitemap from a []FeedEntry using a built-in default template, or an
+// "atom"/"sitemap" page if the app wants to override it.
+//
+// # Template Engines
+//
+// Parsing and execution are delegated to an Engine (Templates.Engine), which
+// defaults to SafehtmlEngine. Swap in a different Engine to change the
+// underlying template syntax/library while keeping layout resolution, output
+// formats and every framework integration unchanged. See Engine and
+// ParsedTemplate.
+//
+// Templates.TemplateFileExtensions additionally maps file extensions to an
+// EngineKind, so non-HTML output (JSON, CSV, RSS, robots.txt, email bodies)
+// can be authored as plain text/template files -- e.g. ".gotxt" -- alongside
+// ".gohtml" pages, without safehtml's context-aware escaping getting in the
+// way. See TextEngine.
+//
+// # Per-Template Functions
+//
+// RegisterFuncsFor(name, fns) merges fns into the function map used only
+// when parsing the layout, page or block named name, so two unrelated
+// pages can each register a function of the same name with a different
+// implementation, instead of both having to share one entry in
+// Templates.funcMap. For a function whose value depends on the request
+// rather than which page it's on, use
+// RegisterDynamicFunc/RegisterDynamicArgFunc instead -- see dynamicfunc.go.
+//
+// # Custom Rewrites
+//
+// This package has no generic "rewrite the parsed template's AST" extension
+// point: safehtml/template ties its context-aware escaping to the parse
+// step itself rather than exposing a separate, mutable parse tree the way
+// html/template historically did, so there's no safe place to splice in an
+// arbitrary post-parse transform without risking the escaping guarantee
+// that is the reason to use safehtml/template at all. The two concrete
+// rewrites that most commonly come up are covered as ordinary FuncMap
+// helpers instead, the same extension point every other helper in this
+// package uses: AddI18nFuncMapHelpers registers a "T" function doing
+// message-catalog lookup with pluralization (see Translator/MapCatalog),
+// and AddAutoTrustedFuncMapHelper registers "auto_trusted" to dispatch a
+// typed CMS field (see CMSField) to the matching trusted_* conversion.
+//
+// # Theme Composition
+//
+// NewLayered composes a project's layouts/pages/blocks with one or more
+// shared template packs (e.g. an embedded "themes/marketing" directory),
+// resolved file-by-file, first hit wins: the project's own copy of a
+// filename always wins, then Templates.Layers in the order given. Use
+// TemplateSource to see which layer a given name actually resolved from.
+//
+// # Compression
+//
+// Setting Templates.Compression to CompressionAuto buffers ExecuteTemplate's
+// output to add a strong ETag, answer If-None-Match with 304, and negotiate
+// a gzip (or brotli, with the "brotli" build tag) response body. See
+// CompressionMode and BufferedResponseWriter. SafeExecuteTemplate builds on
+// the same buffering to guarantee a render error never reaches w at all,
+// calling Templates.ErrorHandler (or RenderError, by default) instead.
+//
+// # Error Pages & Dev Mode
+//
+// RenderError renders a themed "error_<status>"/"error_<class>xx"/"error"
+// page instead of leaking a plain-text 500 -- override that resolution with
+// Templates.ErrorTemplateResolver, and check it was parsed at all with
+// MustHaveErrorTemplates -- and Recoverer turns a panic anywhere in the
+// handler chain into the same themed page. Every framework integration's
+// own recovery middleware (chi's Recoverer, echo's Recover, gin's
+// RecoveryWithTemplates/RecoveryFunc) routes through RenderError the same
+// way, for one consistent error UX regardless of framework. In development,
+// WatchAndReload re-parses templates on file change instead of relying on
+// AlwaysReloadAndParseTemplates, and LiveReloadHandler/LiveReloadScript push
+// the browser to refresh once that happens.
+//
+// # Fragments
+//
+// ExecuteTemplate already strips the layout for an htmx HX-Request (unless
+// HX-Boosted) or any request carrying Unpoly's X-Up-Target header, adding
+// both to Vary; RenderFragment/RenderFragmentWithStatus render one named
+// block on their own, and RenderFragments renders several at once,
+// concatenated as plain HTML or, for a request that sent
+// Accept: text/vnd.turbo-stream.html, as Turbo Stream elements. None of
+// this reads HX-Target/X-Up-Target/X-Up-Fail-Target to pick which block(s)
+// to render -- those headers name a CSS selector or DOM id, not a block
+// name, so mapping one to the other stays app middleware's job, setting
+// HXFragmentContextKey (for RenderFragment) or calling RenderFragments
+// directly.
+//
+// # Request Context
+//
+// RegisterContextProvider("Locale", fn) (and similarly for "CSRFToken",
+// "User", "RequestID", or any other name) registers a per-request value
+// that's reached from a template without threading it through every page
+// and block's own data. ExecuteTemplate evaluates every registered
+// provider into a TemplateContext and, when the page/block data is a
+// map[string]interface{}, injects it under that map's "ctx" key, so
+// `{{.ctx.Locale}}` just works; typed struct data has no spare field to
+// inject into, so the same value is reached there via the "ctx" FuncMap
+// function this also registers -- `{{ctx.Locale}}`, or `{{$ctx := ctx}}`
+// once and `{{$ctx.Locale}}` after that. See TemplateContext and
+// DataRaceCheck.
+//
+// # Section-Scoped Layouts
+//
+// Pages and layouts may live in subdirectories of PagesPath/LayoutsPath
+// ("pages/blog/post.gohtml" registers as page "blog/post"), and a page with
+// no explicit "layout:page" name or LayoutContextKey override picks up the
+// most specific layout for its section automatically: "blog/post" tries
+// layout "blog/application" before falling back to "application" (and
+// "_default/application"), rather than always using DefaultLayout. See
+// LayoutLookup to see or override that resolution order.
 package templates
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -33,6 +158,8 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/safehtml"
 	"github.com/google/safehtml/template"
@@ -44,6 +171,65 @@ import (
 // change the layout for a request.
 type LayoutContextKey struct{}
 
+// HXFragmentContextKey is the key used to store and retrieve the name of a
+// `{{define "block"}}` within the requested page that should be rendered
+// alone, for an htmx/Unpoly-style fragment swap. Set it from middleware based
+// on the HX-Target header or Unpoly's X-Up-Target header, or pass the block
+// name directly to RenderFragment.
+type HXFragmentContextKey struct{}
+
+// OutputFormatContextKey is the key used to store and retrieve an explicit
+// output format name from a request's context, overriding the format that
+// would otherwise be resolved from the URL suffix or Accept header.
+type OutputFormatContextKey struct{}
+
+// OutputFormat describes a named rendering target for a page, inspired by
+// Hugo's output-format system. Registering additional formats lets a single
+// page (e.g. "person") be rendered as HTML, JSON, RSS, AMP, etc. without
+// duplicating routes: the template lookup for a page picks up a
+// format-specific file variant named "<page>.<Suffix>.gohtml" (falling back
+// to the plain "<page>.gohtml" file when no such variant exists).
+type OutputFormat struct {
+	// Name identifies the format, e.g. "html", "json", "rss", "amp".
+	Name string
+
+	// MediaType is written to the response's Content-Type header when this
+	// format is rendered, unless the header has already been set.
+	MediaType string
+
+	// Suffix is the filename suffix used to select the per-format template
+	// variant, e.g. "json" selects "person.json.gohtml" over "person.gohtml".
+	// The "html" format leaves this empty so it resolves to the plain files.
+	Suffix string
+
+	// IsPlainText marks formats whose output isn't HTML, e.g. JSON or RSS.
+	// Reserved for future use by callers that need to pick an escaping strategy.
+	IsPlainText bool
+
+	// Serializer, when set, bypasses template lookup entirely: renderTemplate
+	// marshals data through it directly instead of executing a page
+	// template. Use it for a format with no sensible template
+	// representation, e.g. DefaultOutputFormats' "json" format, which has no
+	// *.json.gohtml file to find.
+	Serializer func(data interface{}) ([]byte, error)
+}
+
+// DefaultOutputFormats are the formats registered by New out of the box.
+// Apps can add to or replace Templates.OutputFormats to register more.
+var DefaultOutputFormats = map[string]OutputFormat{
+	"html": {Name: "html", MediaType: "text/html; charset=utf-8"},
+	"json": {Name: "json", MediaType: "application/json", Suffix: "json", IsPlainText: true, Serializer: jsonSerializer},
+	"rss":  {Name: "rss", MediaType: "application/rss+xml; charset=utf-8", Suffix: "rss", IsPlainText: true},
+	"amp":  {Name: "amp", MediaType: "text/html; charset=utf-8", Suffix: "amp"},
+}
+
+// jsonSerializer is DefaultOutputFormats' "json" Serializer: it marshals data
+// as-is, so a page can be served as JSON without authoring a *.json.gohtml
+// file for it.
+func jsonSerializer(data interface{}) ([]byte, error) {
+	return json.Marshal(data)
+}
+
 const templatesPath = "files/templates"
 const layoutsPath = "layouts"
 const pagesPath = "pages"
@@ -63,6 +249,18 @@ type Templates struct {
 	// Defaults to "application".
 	DefaultLayout string
 
+	// LayoutLookup, when set, overrides the candidate layout names tried for
+	// a page with no explicit "layout:page" name or LayoutContextKey
+	// override -- see resolveTemplateKey. It receives the page's own
+	// section directory (e.g. "blog" for page "blog/post", "" for a
+	// top-level page) and DefaultLayout, and returns layout names to try,
+	// in order; the first one that was actually parsed wins. Defaults to
+	// defaultLayoutLookup: the page's own section, then each ancestor
+	// section, then DefaultLayout itself, then "_default/<DefaultLayout>".
+	// Exposed mainly so a test can observe or pin the resolution order
+	// without depending on the filesystem layout.
+	LayoutLookup func(pageDir, defaultLayout string) []string
+
 	// The file extension for template files. Defaults to ".gohtml".
 	TemplateFileExtension string
 
@@ -82,6 +280,18 @@ type Templates struct {
 	// Defaults to "blocks".
 	BlocksPath string
 
+	// Layers lists additional subdirectories, relative to the same trusted
+	// filesystem as LayoutsPath/PagesPath/BlocksPath, searched for a
+	// layout, page or block file the project's own LayoutsPath/PagesPath/
+	// BlocksPath doesn't provide -- e.g. Layers: []string{"themes/marketing"}
+	// lets "themes/marketing/pages/pricing.gohtml" stand in for a page the
+	// project hasn't written yet. Each layer is expected to mirror the
+	// project's own layout, with its own layouts/pages/blocks
+	// subdirectories; a layer missing one of them is simply skipped. The
+	// project's own directories always win, then layers win in the order
+	// given. See NewLayered and TemplateSource.
+	Layers []string
+
 	// If true, automatically adds helper functions like `d_block`, `locals`,
 	// `references` and `trusted_*` to the template function map. Defaults to true.
 	AddHeadlessCMSFuncMapHelpers bool
@@ -90,14 +300,119 @@ type Templates struct {
 	// Defaults to slog.Default().
 	Logger *slog.Logger
 
-	funcMap template.FuncMap
+	// OnReloadError, when set, is additionally called with the error from
+	// every ParseTemplates reparse that fails, on top of the Logger.Error
+	// WatchAndReload already logs -- for code that wants to alert on a
+	// broken template edit (a Slack webhook, a metrics counter) without
+	// scraping logs for it.
+	OnReloadError func(error)
+
+	// OutputFormats are the named rendering targets (e.g. "html", "json",
+	// "rss") that ExecuteTemplate can resolve a request to. Defaults to
+	// DefaultOutputFormats.
+	OutputFormats map[string]OutputFormat
+
+	// StrictTypeChecking, when true, makes ExecuteTemplate reject a call
+	// whose data argument's type doesn't match the type registered via
+	// CheckTemplate for that page, returning an error before anything is
+	// written to w. Has no effect for pages with no registered type.
+	StrictTypeChecking bool
+
+	// Cache, when set (e.g. via NewLRUCache), memoizes fully-rendered page
+	// output for pages registered via CacheTemplate. Defaults to nil, which
+	// disables caching entirely regardless of registered rules.
+	Cache *LRUCache
+
+	// Engine parses and executes template files whose extension maps to
+	// EngineSafehtml in TemplateFileExtensions. Defaults to a SafehtmlEngine
+	// reading from the configured filesystem; set it to parse those
+	// templates with a different library while keeping layout resolution,
+	// output formats and every framework integration unchanged.
+	Engine Engine
+
+	// TemplateFileExtensions maps a template file extension (including the
+	// leading dot) to the EngineKind that should parse it. Defaults to
+	// DefaultTemplateFileExtensions, which only registers ".gohtml" for
+	// EngineSafehtml. Add entries like ".gotxt", ".gojson" or ".gorss"
+	// mapped to EngineText to author those pages with text/template instead
+	// -- handy for output that isn't HTML (JSON, CSV, RSS, robots.txt, email
+	// bodies) and so doesn't need safehtml's context-aware escaping. A
+	// layout only combines with pages and blocks parsed by the same engine.
+	TemplateFileExtensions map[string]EngineKind
+
+	// Engines maps an EngineKind other than EngineSafehtml (which always
+	// uses Engine) to the Engine instance that parses and executes its
+	// files. Defaults to a TextEngine for EngineText, reading from the same
+	// filesystem as Engine.
+	Engines map[EngineKind]Engine
+
+	// Compression controls whether ExecuteTemplate buffers its output to add
+	// an ETag, honor If-None-Match, and negotiate a compressed response
+	// body. Defaults to CompressionOff. Set to CompressionAuto to enable it
+	// for every render that reaches an http.ResponseWriter through
+	// ExecuteTemplate or a BufferedResponseWriter's Finish; Echo's c.Render
+	// hands ExecuteTemplate a plain buffer and so gets none of it, and Gin's
+	// c.HTML, which has no *http.Request, gets the ETag but no negotiation.
+	Compression CompressionMode
+
+	// MaxBufferSize caps how large a NewBufferedResponseWriter is allowed to
+	// grow while a framework integration (stdlib, chi, gin, chirender)
+	// renders into it before committing the status code and body. 0 (the
+	// default) means unbounded. Exceeding it fails the render with an error
+	// instead of ever flushing a partial response. SafeExecuteTemplate is
+	// also bounded by it, for a runaway template (e.g. an unbounded
+	// {{range}}) that would otherwise buffer without limit.
+	MaxBufferSize int
+
+	// ErrorHandler is called by SafeExecuteTemplate when ExecuteTemplate
+	// fails before anything has reached w, in place of its default of
+	// rendering the themed "error" page with a 500 via RenderError.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+	// ErrorTemplateResolver overrides RenderError/RenderErrorWithData's
+	// candidate list for a given status (tried in order, first one parsed
+	// wins); defaults to errorTemplateCandidates, i.e.
+	// "error_<status>", "error_<class>xx", "error". Set it to change the
+	// naming scheme (e.g. a "pages/errors/<status>" layout) without
+	// reimplementing RenderError.
+	ErrorTemplateResolver func(status int) []string
+
+	// DataRaceCheck, when true, tags each TemplateContext RegisterContextProvider
+	// builds for a request with the goroutine that built it, and panics if
+	// one of its accessors (Get, Locale, CSRFToken, ...) is ever called from
+	// a different goroutine -- catching a handler that stashed the context
+	// value and read it from a goroutine it spawned, instead of silently
+	// risking an unsynchronized read. Off by default for the usual case of
+	// ExecuteTemplate and everything it calls running on one goroutine.
+	DataRaceCheck bool
+
+	funcMap          template.FuncMap
+	perTemplateFuncs map[string]template.FuncMap
+	typeChecks       map[string]reflect.Type
+	cacheRules       map[string]CacheRule
+	contextProviders map[string]func(*http.Request) any
+
+	dynamicFuncs     map[string]func(*http.Request) any
+	dynamicArgFuncs  map[string]func(r *http.Request, args ...any) any
+	dynamicPools     map[ParsedTemplate]*sync.Pool
+	dynamicPoolsLock sync.Mutex
 
 	fileSystem        fs.FS
 	fileSystemTrusted template.TrustedFS
 	fileSystemIsEmbed bool
+	root              string // see NewWithRoot; templatesPath for New
+
+	overlayFileSystem        fs.FS // see AddOverlay; nil if no overlay was added
+	overlayFileSystemIsEmbed bool
+
+	current      atomic.Pointer[parsedSet]
+	parseLock    sync.Mutex
+	partialCache sync.Map // see partial.go; cleared by ParseTemplates
 
-	templates     map[string]*template.Template
-	templatesLock sync.RWMutex
+	liveReloadHub  *liveReloadHub
+	liveReloadOnce sync.Once
+
+	watcherCancel context.CancelFunc
 }
 
 // New creates a new Templates instance from a filesystem and a custom function map.
@@ -110,28 +425,29 @@ type Templates struct {
 //   - fnMap: A `template.FuncMap` containing custom functions to make available
 //     within templates. Can be nil if no custom functions are needed.
 //
-// Returns a new, configured *Templates instance.
+// Returns a new, configured *Templates instance. It's NewWithRoot with root
+// fixed to templatesPath ("files/templates") -- use NewWithRoot directly to
+// serve templates from elsewhere, e.g. a temp directory in a test.
 func New(fsys fs.FS, fnMap template.FuncMap) *Templates {
-	var trustedFileSystem template.TrustedFS
-	var fileSystemForParsing fs.FS
-	isEmbed := false
+	return NewWithRoot(fsys, fnMap, templatesPath)
+}
 
-	switch v := fsys.(type) {
-	case nil:
-		// Default to OS filesystem, chrooted to the templates path.
-		fileSystemForParsing = os.DirFS(templatesPath)
-		trustedFileSystem = template.TrustedFSFromTrustedSource(template.TrustedSourceFromConstant(templatesPath))
-	case *embed.FS:
-		// It's an embedded filesystem.
-		sub, err := fs.Sub(v, templatesPath)
-		if err != nil {
-			panic(fmt.Errorf("unable to create sub-filesystem for templates: %w", err))
-		}
-		fileSystemForParsing = sub
-		trustedFileSystem = template.TrustedFSFromEmbed(*v)
-		isEmbed = true
-	default:
-		panic("templates.New: provided fsys is not an *embed.FS or nil. Due to security constraints in the underlying safehtml/template library, only embedded filesystems or the OS filesystem (when fsys is nil) are supported.")
+// NewWithRoot is New, but rooted at root instead of the fixed templatesPath
+// ("files/templates"). fsys's constraints are the same as New's: nil for the
+// OS filesystem (root is then a path relative to the working directory, or
+// absolute) or an *embed.FS (root is then the embedded directory to serve
+// from, e.g. a build tag could embed multiple template sets side by side
+// and pick one by root). Panics if root is empty, since every path
+// ParseTemplates resolves -- LayoutsPath, PagesPath, BlocksPath, each
+// Layers entry -- is relative to it.
+func NewWithRoot(fsys fs.FS, fnMap template.FuncMap, root string) *Templates {
+	if root == "" {
+		panic("templates.NewWithRoot: root must not be empty")
+	}
+
+	fileSystemForParsing, _, trustedFileSystem, isEmbed, err := resolveFS(fsys, root)
+	if err != nil {
+		panic(fmt.Errorf("templates.NewWithRoot: %w", err))
 	}
 
 	t := &Templates{
@@ -143,11 +459,18 @@ func New(fsys fs.FS, fnMap template.FuncMap) *Templates {
 
 		AddHeadlessCMSFuncMapHelpers: true, // d_block, trust_html
 		Logger:                       slog.Default(),
+		OutputFormats:                DefaultOutputFormats,
 		funcMap:                      fnMap,
 
 		fileSystem:        fileSystemForParsing,
 		fileSystemTrusted: trustedFileSystem,
 		fileSystemIsEmbed: isEmbed,
+		root:              root,
+	}
+	t.Engine = NewSafehtmlEngine(trustedFileSystem)
+	t.TemplateFileExtensions = DefaultTemplateFileExtensions
+	t.Engines = map[EngineKind]Engine{
+		EngineText: NewTextEngine(fileSystemForParsing),
 	}
 
 	t.AddFuncMapHelpers()
@@ -155,6 +478,121 @@ func New(fsys fs.FS, fnMap template.FuncMap) *Templates {
 	return t
 }
 
+// resolveFS turns one of New's/NewWithRoot's fsys arguments, plus the root
+// it's rooted at, into the views ParseTemplates and the Engines need:
+// parsing is what directory listing (getFilePathsInDir) and TextEngine read
+// from, already rooted so its paths have no root prefix; resolving is the
+// filesystem whose paths match what ParseTemplates hands to
+// Engine.ParseFiles -- the same as parsing for the OS case, but the
+// un-subdirectoried embed.FS for the embedded case, since trusted only ever
+// wraps the full embed.FS (TrustedFSFromEmbed takes no subdirectory) and so
+// needs root joined back onto each path (see getFilePathsInDir's
+// prefixTemplatesPath). AddOverlay calls this a second time, for overlay
+// instead of fsys, to resolve the same three views for it.
+func resolveFS(fsys fs.FS, root string) (parsing fs.FS, resolving fs.FS, trusted template.TrustedFS, isEmbed bool, err error) {
+	switch v := fsys.(type) {
+	case nil:
+		parsing = os.DirFS(root)
+		resolving = parsing
+		ts, err := trustedSourceFromRoot(root)
+		if err != nil {
+			return nil, nil, template.TrustedFS{}, false, err
+		}
+		trusted = template.TrustedFSFromTrustedSource(ts)
+	case *embed.FS:
+		sub, err := fs.Sub(v, root)
+		if err != nil {
+			return nil, nil, template.TrustedFS{}, false, fmt.Errorf("unable to create sub-filesystem for templates: %w", err)
+		}
+		parsing = sub
+		resolving = *v
+		trusted = template.TrustedFSFromEmbed(*v)
+		isEmbed = true
+	default:
+		return nil, nil, template.TrustedFS{}, false, errors.New("provided fsys is not an *embed.FS or nil. Due to security constraints in the underlying safehtml/template library, only embedded filesystems or the OS filesystem (when fsys is nil) are supported")
+	}
+	return parsing, resolving, trusted, isEmbed, nil
+}
+
+// trustedSourceFromRoot builds a TrustedSource for root, a path only known at
+// runtime (e.g. read from a flag or config file), one path segment at a
+// time. safehtml/template deliberately has no constructor that takes an
+// arbitrary runtime string directly -- TrustedSourceFromConstant requires an
+// untyped string constant -- so this folds root through repeated calls to
+// TrustedSourceFromConstantDir, which accepts one dynamic filename per call
+// and rejects any segment containing a path separator or "..". That keeps
+// the traversal-prevention guarantee safehtml is built around: the result is
+// exactly root, never anything an attacker-controlled segment could have
+// escaped out of.
+func trustedSourceFromRoot(root string) (template.TrustedSource, error) {
+	src := template.TrustedSourceFromConstant("")
+	for _, segment := range strings.Split(filepath.ToSlash(root), "/") {
+		if segment == "" {
+			continue
+		}
+		var err error
+		src, err = template.TrustedSourceFromConstantDir("", src, segment)
+		if err != nil {
+			return template.TrustedSource{}, fmt.Errorf("trustedSourceFromRoot: %w", err)
+		}
+	}
+	return src, nil
+}
+
+// NewLayered creates a Templates instance the same way New does, then sets
+// Layers so ParseTemplates also fills in any layout, page or block the
+// project's own LayoutsPath/PagesPath/BlocksPath doesn't provide from one of
+// layers, in order. This is a Hugo-style theme/component composition model
+// for publishing a reusable template pack as a shared subdirectory of the
+// same trusted filesystem -- New's fsys constraints (nil or *embed.FS) still
+// apply, since every layer has to come from that one already-trusted root.
+// Each layer is a path like "themes/marketing", expected to have its own
+// layouts/pages/blocks subdirectories mirroring the project's.
+func NewLayered(fsys fs.FS, fnMap template.FuncMap, layers ...string) *Templates {
+	t := New(fsys, fnMap)
+	t.Layers = layers
+	return t
+}
+
+// NewWithOverlay is NewWithRoot, with overlay added via AddOverlay before
+// returning -- e.g. NewWithOverlay(embeddedDefaults, nil, fnMap, "files/templates")
+// ships default templates in an embedded build and lets a deployer override
+// individual files from a directory on disk, without forking the whole
+// template set.
+func NewWithOverlay(base fs.FS, overlay fs.FS, fnMap template.FuncMap, root string) *Templates {
+	t := NewWithRoot(base, fnMap, root)
+	t.AddOverlay(overlay)
+	return t
+}
+
+// AddOverlay layers overlay on top of the filesystem Templates was built
+// from. ParseTemplates still walks LayoutsPath/PagesPath/BlocksPath the same
+// way, but for any layout, page or block overlay provides at the same
+// relative path, it reads that file instead of the base filesystem's copy --
+// "first hit wins" the other way round from Layers, which only fills in
+// what the project doesn't already have. overlay is resolved against the
+// same root as the base filesystem and is subject to the same fsys
+// constraints as New's: nil for the OS filesystem, or an *embed.FS.
+//
+// AddOverlay reconfigures the default SafehtmlEngine and TextEngine it finds
+// on Templates.Engine/Templates.Engines -- if either was already replaced
+// with a custom Engine, wire overlay support into it directly instead.
+func (t *Templates) AddOverlay(overlay fs.FS) {
+	parsing, resolving, trusted, isEmbed, err := resolveFS(overlay, t.root)
+	if err != nil {
+		panic(fmt.Errorf("templates.AddOverlay: %w", err))
+	}
+	t.overlayFileSystem = parsing
+	t.overlayFileSystemIsEmbed = isEmbed
+
+	if se, ok := t.Engine.(*SafehtmlEngine); ok {
+		se.SetOverlay(trusted, resolving)
+	}
+	if te, ok := t.Engines[EngineText].(*TextEngine); ok {
+		te.SetOverlay(parsing)
+	}
+}
+
 // AddFuncMapHelpers populates the template function map with the default helpers
 // if `AddHeadlessCMSFuncMapHelpers` is true. It will panic if a function name
 // is already in use.
@@ -164,10 +602,67 @@ func (t *Templates) AddFuncMapHelpers() {
 	}
 	if t.AddHeadlessCMSFuncMapHelpers {
 		t.AddDynamicBlockToFuncMap()
+		t.AddDynamicCachedBlockToFuncMap()
 		t.addTrustedConverterFuncs()
 		t.AddLocalsToFuncMap()
 		t.AddReferencesToFuncMap()
+		t.AddPartialFuncMapHelpers()
+	}
+}
+
+// RegisterFuncsFor merges fns into the function map used only when parsing
+// the layout, page or block named name, on top of t's global function map --
+// instead of adding to t.funcMap itself, where a name reused across two
+// unrelated pages would force them to share one implementation. Call it
+// before ParseTemplates (or before the next reload, if
+// AlwaysReloadAndParseTemplates is set) for it to take effect; it has no
+// effect on an already-parsed template.
+//
+// For a function whose value depends on the request rather than which page
+// it's on (e.g. current_user, or csrf_token/csrf_field via EnableCSRF), use
+// RegisterDynamicFunc/RegisterDynamicArgFunc instead -- those resolve once
+// per request via a pooled clone rather than requiring a re-parse per page.
+func (t *Templates) RegisterFuncsFor(name string, fns template.FuncMap) {
+	if t.perTemplateFuncs == nil {
+		t.perTemplateFuncs = map[string]template.FuncMap{}
+	}
+	merged := t.perTemplateFuncs[name]
+	if merged == nil {
+		merged = template.FuncMap{}
+	}
+	for fnName, fn := range fns {
+		merged[fnName] = fn
+	}
+	t.perTemplateFuncs[name] = merged
+}
+
+// funcMapFor returns the FuncMap to parse the templates named names with:
+// t.funcMap overlaid with any RegisterFuncsFor entries registered for names,
+// applied in the order given so a later name's override wins over an
+// earlier one (e.g. a page's own override beats its layout's). Returns
+// t.funcMap itself, unmodified, when none of names has a registered
+// override -- the common case -- to avoid copying it on every parse.
+func (t *Templates) funcMapFor(names ...string) template.FuncMap {
+	hasOverride := false
+	for _, name := range names {
+		if len(t.perTemplateFuncs[name]) > 0 {
+			hasOverride = true
+			break
+		}
 	}
+	if !hasOverride {
+		return t.funcMap
+	}
+	merged := make(template.FuncMap, len(t.funcMap))
+	for fnName, fn := range t.funcMap {
+		merged[fnName] = fn
+	}
+	for _, name := range names {
+		for fnName, fn := range t.perTemplateFuncs[name] {
+			merged[fnName] = fn
+		}
+	}
+	return merged
 }
 
 // MustParseTemplates parses all template files from the configured filesystem.
@@ -177,61 +672,81 @@ func (t *Templates) MustParseTemplates() {
 	t.fatalOnErr(t.ParseTemplates())
 }
 
-// ParseTemplates reads and parses all template files from the configured layouts,
-// pages, and blocks directories. It populates the internal template map.
-// This method is safe for concurrent use.
+// ParseTemplates reads and parses all template files from the configured
+// layouts, pages and blocks directories. It walks LayoutsPath/PagesPath/
+// BlocksPath and (re)builds the parsed template set. It only replaces the
+// live set -- t.current and t.Cache -- once every layout, page and block has
+// parsed successfully and every CheckTemplate type check against the new
+// set has passed; on any failure it returns the error with the previously
+// parsed set still in place, so a bad edit caught by WatchAndReload never
+// takes a running server's templates down. The swap is a single
+// atomic.Pointer store, so ExecuteTemplate and everything it calls (see
+// parsedSet) never takes a lock to read the set, even while a reload is in
+// flight.
+//
+// Most failures -- a missing layouts directory, a block whose {{define}}
+// name doesn't match its filename, a duplicate block, a Go template syntax
+// error -- come back as a *ParseError; use errors.As to recover Kind, File,
+// Line, Column and a Snippet of surrounding source, or pass the error to
+// FormatParseError for a dev-mode report. Error() still renders a plain
+// string for callers that don't care (a CheckTemplate type mismatch from
+// checkRegisteredTypes is the one failure that isn't a *ParseError).
 func (t *Templates) ParseTemplates() error {
-	t.templates = make(map[string]*template.Template)
+	newTemplates := make(map[string]ParsedTemplate)
+	newTemplateSources := make(map[string]templateSource)
 	hfs := http.FS(t.fileSystem)
-	layouts, err := getFilePathsInDir(hfs, t.LayoutsPath, t.fileSystemIsEmbed)
+	layouts, err := t.resolveLayeredDir(hfs, t.LayoutsPath, newTemplateSources, true)
 	if err != nil {
-		return fmt.Errorf("reading layout files: %w", err)
+		return newParseError(ParseErrorIO, t.LayoutsPath, 0, 0, fmt.Errorf("reading layout files: %w", err))
 	}
 	numberOfLayouts := len(layouts)
-	pages, err := getFilePathsInDir(hfs, t.PagesPath, t.fileSystemIsEmbed)
+	pages, err := t.resolveLayeredDir(hfs, t.PagesPath, newTemplateSources, true)
 	if err != nil {
-		return fmt.Errorf("reading pages: %w", err)
+		return newParseError(ParseErrorIO, t.PagesPath, 0, 0, fmt.Errorf("reading pages: %w", err))
 	}
-	blocks, err := getFilePathsInDir(hfs, t.BlocksPath, t.fileSystemIsEmbed)
+	blocks, err := t.resolveLayeredDir(hfs, t.BlocksPath, newTemplateSources, false)
 	if err != nil {
-		return fmt.Errorf("reading shared blocks: %w", err)
+		return newParseError(ParseErrorIO, t.BlocksPath, 0, 0, fmt.Errorf("reading shared blocks: %w", err))
 	}
 	if numberOfLayouts == 0 {
-		return errors.New("you need at least one layout")
+		return newParseError(ParseErrorMissingLayouts, "", 0, 0, errors.New("you need at least one layout"))
 	}
 
-	for _, layoutFilePath := range layouts {
-		for _, pageFilePath := range pages {
-			files := append(blocks, pageFilePath, layoutFilePath)
-			layoutFilename := filepath.Base(layoutFilePath)
-			layoutName := strings.TrimSuffix(layoutFilename, path.Ext(layoutFilename))
-			pageFilename := filepath.Base(pageFilePath)
-			pageName := strings.TrimSuffix(pageFilename, path.Ext(pageFilename))
-			newTemplate, err := parseNewTemplateWithFuncMap("", t.funcMap, t.fileSystemTrusted, files...)
+	for _, layoutFile := range layouts {
+		for _, pageFile := range pages {
+			// A layout and page can only be parsed together by the same
+			// Engine, so a ".gotxt" page (EngineText) never pairs with a
+			// ".gohtml" layout (EngineSafehtml); it's combined with blocks
+			// below instead, via the no-layout ":page" entry.
+			if pageFile.kind != layoutFile.kind {
+				continue
+			}
+			files := append(filePathsOfKind(blocks, layoutFile.kind), pageFile.path, layoutFile.path)
+			layoutName := layoutFile.relName
+			pageName := pageFile.relName
+			newTemplate, err := t.engineFor(layoutFile.kind).ParseFiles(t.funcMapFor(layoutName, pageName), files...)
 			if err != nil {
-				return fmt.Errorf("%s: %w", pageName, err)
+				return classifyParseFilesError(pageFile.path, fmt.Errorf("%s: %w", pageName, err))
 			}
-			t.templates[layoutName+":"+pageName] = newTemplate // sample 'application:products' aka 'layout:pageName'
+			newTemplates[layoutName+":"+pageName] = newTemplate // sample 'application:products' aka 'layout:pageName'
 		}
 	}
 	// Page   "page" + blocks
-	for _, pageFilePath := range pages {
-		files := append(blocks, pageFilePath) // blocks and this one page file will end up in a template
-		pageFilename := filepath.Base(pageFilePath)
-		pageName := strings.TrimSuffix(pageFilename, path.Ext(pageFilename))
-		newTemplate, err := parseNewTemplateWithFuncMap("", t.funcMap, t.fileSystemTrusted, files...)
+	for _, pageFile := range pages {
+		files := append(filePathsOfKind(blocks, pageFile.kind), pageFile.path) // same-kind blocks and this one page file will end up in a template
+		pageName := pageFile.relName
+		newTemplate, err := t.engineForFile(pageFile).ParseFiles(t.funcMapFor(pageName), files...)
 		if err != nil {
-			return fmt.Errorf("%s: %w", pageName, err)
+			return classifyParseFilesError(pageFile.path, fmt.Errorf("%s: %w", pageName, err))
 		}
-		t.templates[":"+pageName] = newTemplate // sample ':products'
+		newTemplates[":"+pageName] = newTemplate // sample ':products'
 	}
 	// Blocks with prefix '_'
-	for _, blockFilePath := range blocks {
-		blockFilename := filepath.Base(blockFilePath)
-		blockName := strings.TrimSuffix(blockFilename, path.Ext(blockFilename))
-		newTemplate, err := parseNewTemplateWithFuncMap("", t.funcMap, t.fileSystemTrusted, blockFilePath)
+	for _, blockFile := range blocks {
+		blockName := blockFile.relName
+		newTemplate, err := t.engineFor(blockFile.kind).ParseFiles(t.funcMapFor(blockName), blockFile.path)
 		if err != nil {
-			return fmt.Errorf("%s: %w", blockFilePath, err)
+			return classifyParseFilesError(blockFile.path, fmt.Errorf("%s: %w", blockFile.path, err))
 		}
 
 		prefixedBlockName := blockName
@@ -239,21 +754,35 @@ func (t *Templates) ParseTemplates() error {
 			prefixedBlockName = "_" + blockName
 		}
 
-		if _, exists := t.templates[prefixedBlockName]; exists || !definedTemplatesContain(newTemplate, prefixedBlockName) {
-			return fmt.Errorf("error reason 1: block already defined as key or reason 2: the filename doesn't match a definition within the file block_filename %s defined_name %s", blockFilename, blockName)
+		if _, exists := newTemplates[prefixedBlockName]; exists {
+			return newParseError(ParseErrorDuplicateBlock, blockFile.path, 0, 0, fmt.Errorf("error reason 1: block already defined as key or reason 2: the filename doesn't match a definition within the file block_filename %s defined_name %s", blockFile.path, blockName))
 		}
-		t.templates[prefixedBlockName] = newTemplate // sample '_grid'
+		if !definedTemplatesContain(newTemplate, prefixedBlockName) {
+			return newParseError(ParseErrorBlockNameMismatch, blockFile.path, 0, 0, fmt.Errorf("error reason 1: block already defined as key or reason 2: the filename doesn't match a definition within the file block_filename %s defined_name %s", blockFile.path, blockName))
+		}
+		newTemplates[prefixedBlockName] = newTemplate // sample '_grid'
+	}
+	if err := t.checkRegisteredTypes(newTemplates); err != nil {
+		return err
+	}
+
+	t.current.Store(&parsedSet{templates: newTemplates, sources: newTemplateSources})
+	if t.Cache != nil {
+		t.Cache.reset()
 	}
+	t.partialCache.Range(func(key, _ interface{}) bool {
+		t.partialCache.Delete(key)
+		return true
+	})
+	t.dynamicPoolsLock.Lock()
+	t.dynamicPools = nil
+	t.dynamicPoolsLock.Unlock()
 	return nil
 }
 
-func definedTemplatesContain(t *template.Template, name string) bool {
-	templates := t.Templates()
-	for _, tmpl := range templates {
-		if tmpl.Tree == nil || tmpl.Tree.Root.Pos == 0 {
-			continue
-		}
-		if tmpl.Name() == name {
+func definedTemplatesContain(t ParsedTemplate, name string) bool {
+	for _, defined := range t.DefinedTemplates() {
+		if defined == name {
 			return true
 		}
 	}
@@ -277,65 +806,659 @@ func definedTemplatesContain(t *template.Template, name string) bool {
 func (t *Templates) ExecuteTemplate(w io.Writer, r *http.Request, templateName string, data interface{}) error {
 	// dev mode for example
 	if t.AlwaysReloadAndParseTemplates {
-		if t.templatesLock.TryLock() {
+		// parseLock just makes sure concurrent requests don't all reparse at
+		// once; TryLock skips reparsing this request if another one is
+		// already doing it. It doesn't guard t.current -- ParseTemplates
+		// swaps that in atomically.
+		if t.parseLock.TryLock() {
 			err := t.ParseTemplates()
-			t.templatesLock.Unlock()
+			t.parseLock.Unlock()
 			if err != nil {
 				return err
 			}
 		}
-		t.templatesLock.RLock()
-		defer t.templatesLock.RUnlock()
 	}
-
 	if templateName == "" {
 		templateName = "error"
 	}
 
+	if t.StrictTypeChecking {
+		if pageName := pageNameFromTemplateName(templateName); pageName != "" {
+			if want, ok := t.typeChecks[pageName]; ok && data != nil && reflect.TypeOf(data) != want {
+				return fmt.Errorf("template: StrictTypeChecking: page %q expects data of type %s, got %T", pageName, want, data)
+			}
+		}
+	}
+
+	if len(t.contextProviders) > 0 {
+		if m, ok := data.(map[string]interface{}); ok {
+			merged := make(map[string]interface{}, len(m)+1)
+			for k, v := range m {
+				merged[k] = v
+			}
+			merged["ctx"] = t.buildContext(r)
+			data = merged
+		}
+	}
+
+	if r != nil && !strings.HasPrefix(templateName, "_") {
+		if rw, ok := w.(http.ResponseWriter); ok {
+			rw.Header().Add("Vary", "HX-Request")
+			rw.Header().Add("Vary", "X-Up-Target")
+			if block, ok := r.Context().Value(HXFragmentContextKey{}).(string); ok && block != "" {
+				return t.RenderFragment(rw, r, templateName, block, data)
+			}
+		}
+		// A fragment-swap request -- htmx's HX-Request, or Unpoly's
+		// X-Up-Target naming the fragment it's replacing -- already has the
+		// surrounding page in the DOM, so render it as if ":name" (no
+		// layout) had been requested -- unless it was HX-Boosted, which
+		// still expects a full page since it's simulating a regular browser
+		// navigation.
+		isFragmentRequest := (r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-Boosted") != "true") ||
+			r.Header.Get("X-Up-Target") != ""
+		if isFragmentRequest && !strings.HasPrefix(templateName, ":") && !strings.Contains(templateName, ":") {
+			templateName = ":" + templateName
+		}
+	}
+
+	format := t.ResolveOutputFormat(r)
+	if rw, ok := w.(http.ResponseWriter); ok && format.MediaType != "" {
+		if rw.Header().Get("Content-Type") == "" {
+			rw.Header().Set("Content-Type", format.MediaType)
+		}
+	}
+
+	if t.Compression == CompressionAuto {
+		if rw, ok := w.(http.ResponseWriter); ok {
+			// A BufferedResponseWriter already owns compression/status via
+			// its own Finish call; don't double-compress its buffer here.
+			if _, buffered := rw.(*BufferedResponseWriter); !buffered {
+				body, err := t.renderToBytes(r, templateName, data, format)
+				if err != nil {
+					return err
+				}
+				return t.compressAndWrite(rw, r, http.StatusOK, body)
+			}
+		}
+	}
+
+	if t.Cache != nil {
+		body, handled, err := t.executeTemplateCached(r, templateName, data, format)
+		if handled {
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(body)
+			return err
+		}
+	}
+
+	return t.renderTemplate(w, r, templateName, data, format)
+}
+
+// renderToBytes renders templateName to a byte slice, serving it from
+// t.Cache when it applies. Used by the CompressionAuto path, which needs the
+// fully-rendered body before it can compute an ETag or negotiate
+// Accept-Encoding.
+func (t *Templates) renderToBytes(r *http.Request, templateName string, data interface{}, format OutputFormat) ([]byte, error) {
+	if t.Cache != nil {
+		if body, handled, err := t.executeTemplateCached(r, templateName, data, format); handled {
+			return body, err
+		}
+	}
+	var buf bytes.Buffer
+	if err := t.renderTemplate(&buf, r, templateName, data, format); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cacheParams resolves the cache key/ttl/eligibility for templateName and
+// data: a CacheRule registered via CacheTemplate for the page takes
+// precedence, inspecting the request; failing that, data's own
+// Cacheable.CacheKey is used if it implements that interface.
+func (t *Templates) cacheParams(r *http.Request, templateName string, data interface{}) (key string, ttl time.Duration, ok bool) {
+	if rule, hasRule := t.cacheRules[pageNameFromTemplateName(templateName)]; hasRule {
+		return rule(r)
+	}
+	if cacheable, isCacheable := data.(Cacheable); isCacheable {
+		return cacheable.CacheKey()
+	}
+	return "", 0, false
+}
+
+// executeTemplateCached serves templateName's rendered bytes from t.Cache
+// when cacheParams allows it, rendering and populating the cache on a miss.
+// handled is false when this request isn't cacheable, in which case the
+// caller should fall back to a plain render. See CacheTemplate and Cacheable.
+func (t *Templates) executeTemplateCached(r *http.Request, templateName string, data interface{}, format OutputFormat) (body []byte, handled bool, err error) {
+	key, ttl, cacheable := t.cacheParams(r, templateName, data)
+	if !cacheable {
+		return nil, false, nil
+	}
+	if cached, hit := t.Cache.get(key); hit {
+		return cached, true, nil
+	}
+	var buf bytes.Buffer
+	if err := t.renderTemplate(&buf, r, templateName, data, format); err != nil {
+		return nil, true, err
+	}
+	t.Cache.set(key, buf.Bytes(), ttl)
+	return buf.Bytes(), true, nil
+}
+
+// renderTemplate dispatches templateName (in its "layout:page", ":page", or
+// "page" form) to the parsed template for format and executes it. This is
+// the part of ExecuteTemplate that CacheTemplate can redirect into a buffer.
+func (t *Templates) renderTemplate(w io.Writer, r *http.Request, templateName string, data interface{}, format OutputFormat) error {
+	if format.Serializer != nil {
+		body, err := format.Serializer(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(body)
+		return err
+	}
+
 	// block/snippet/partial
 	if strings.HasPrefix(templateName, "_") {
-		tmpl, ok := t.templates[templateName]
+		tmpl, ok := t.currentSet().templates[templateName]
 		if !ok {
 			return errors.New("template: name not found ->" + templateName)
 		}
-		return tmpl.ExecuteTemplate(w, templateName, data) // block has template name defined, so only render that
+		return t.executeDynamic(tmpl, w, r, templateName, data) // block has template name defined, so only render that
+	}
+
+	key, entryPoint, err := t.resolveTemplateKey(templateName, r)
+	if err != nil {
+		return err
+	}
+	tmpl, ok := t.lookupForFormat(key, format)
+	if !ok {
+		return errors.New("template: name not found ->" + templateName)
 	}
-	// page only
+	return t.executeDynamic(tmpl, w, r, entryPoint, data)
+}
+
+// resolveTemplateKey expands templateName into its full "layout:page" lookup
+// key and the name of the entrypoint defined within that file to execute:
+// "page" for the no-layout (":page") form, "layout" otherwise. A layout
+// already set via LayoutContextKey on r takes precedence; failing that, the
+// page's own section picks its layout via resolveSectionLayout instead of
+// always using DefaultLayout. It errors only in that last case, when none of
+// the section's candidate layouts were actually parsed.
+func (t *Templates) resolveTemplateKey(templateName string, r *http.Request) (key string, entryPoint string, err error) {
 	if strings.HasPrefix(templateName, ":") {
-		tmpl, ok := t.templates[templateName]
-		if !ok {
-			return errors.New("template: name not found ->" + templateName)
+		return templateName, "page", nil
+	}
+	if strings.Contains(templateName, ":") {
+		return templateName, "layout", nil
+	}
+
+	if r != nil {
+		if layout, ok := r.Context().Value(LayoutContextKey{}).(string); ok {
+			return fmt.Sprint(layout, ":", templateName), "layout", nil
 		}
-		return tmpl.ExecuteTemplate(w, "page", data) // render page only including its blocks (every page is defined as "page" within the file for layout combination reasons as we don't have yield)
 	}
 
-	// with layout defined in templateName
-	if strings.Contains(templateName, ":") {
-		tmpl, ok := t.templates[templateName]
-		if !ok {
-			return errors.New("template: name not found ->" + templateName)
+	layout, err := t.resolveSectionLayout(templateName)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprint(layout, ":", templateName), "layout", nil
+}
+
+// resolveSectionLayout picks the layout a page with no explicit layout
+// (neither a "layout:page" name nor a LayoutContextKey override) renders
+// with. It asks LayoutLookup (or defaultLayoutLookup, if unset) for
+// candidate layout names, most specific first, and returns the first one
+// that was actually parsed -- so "blog/post" picks up layout "blog/
+// application" if LayoutsPath has one, otherwise falls back to
+// "_default/application" or plain "application". If none of the candidates
+// parsed, the error lists every one that was tried.
+func (t *Templates) resolveSectionLayout(pageName string) (string, error) {
+	lookup := t.LayoutLookup
+	if lookup == nil {
+		lookup = defaultLayoutLookup
+	}
+	pageDir := path.Dir(pageName)
+	if pageDir == "." {
+		pageDir = ""
+	}
+	candidates := lookup(pageDir, t.DefaultLayout)
+	for _, candidate := range candidates {
+		if _, ok := t.currentSet().templates[candidate+":"+pageName]; ok {
+			return candidate, nil
 		}
-		return tmpl.ExecuteTemplate(w, "layout", data)
 	}
+	return "", fmt.Errorf("templates: no layout found for page %q, tried: %s", pageName, strings.Join(candidates, ", "))
+}
 
-	// with layout [from request-context or default from config]
-	layoutIsSetInContext := false
-	if r != nil {
-		var layout string
-		layout, layoutIsSetInContext = r.Context().Value(LayoutContextKey{}).(string)
-		if layoutIsSetInContext {
-			templateName = fmt.Sprint(layout, ":", templateName)
+// defaultLayoutLookup is LayoutLookup's default: pageDir's own section
+// layout, then each ancestor section's, then "" (bare defaultLayout), then
+// "_default/<defaultLayout>" as the final fallback -- e.g. for pageDir
+// "blog/2026", defaultLayout "application": "blog/2026/application",
+// "blog/application", "application", "_default/application".
+func defaultLayoutLookup(pageDir, defaultLayout string) []string {
+	var candidates []string
+	for dir := pageDir; ; dir = path.Dir(dir) {
+		if dir == "" || dir == "." {
+			candidates = append(candidates, defaultLayout)
+			break
 		}
+		candidates = append(candidates, path.Join(dir, defaultLayout))
 	}
-	if !layoutIsSetInContext {
-		templateName = fmt.Sprint(t.DefaultLayout, ":", templateName)
+	candidates = append(candidates, path.Join("_default", defaultLayout))
+	return candidates
+}
+
+// RenderFragment renders a single `{{define "block"}}...{{end}}` defined
+// within templateName's page or layout file, instead of the whole page. This
+// is the building block for htmx/Unpoly-style partial updates that swap one
+// fragment into an already-rendered page: pick the block to render from the
+// HX-Target header (via a middleware that sets HXFragmentContextKey) or pass
+// it explicitly. Sets Content-Type: text/html and Vary: HX-Request unless
+// Content-Type is already set. The response status is left at whatever w
+// defaults to (200); use RenderFragmentWithStatus to set one explicitly.
+func (t *Templates) RenderFragment(w http.ResponseWriter, r *http.Request, templateName, block string, data interface{}) error {
+	return t.RenderFragmentWithStatus(w, r, 0, templateName, block, data)
+}
+
+// RenderFragmentWithStatus is RenderFragment, but commits status via
+// WriteHeader once rendering succeeds, instead of leaving it at w's default.
+// Both render into a pooled buffer first (see NewBufferedResponseWriter), so
+// a failure partway through a fragment never leaves a partial body on the
+// wire; status of 0 means "don't call WriteHeader at all" (RenderFragment's
+// behavior). w may already be a *BufferedResponseWriter (e.g. when
+// ExecuteTemplate dispatches here for an HXFragmentContextKey request from
+// inside a framework integration's own buffered Render), in which case the
+// outer call owns committing it and this one just renders into it directly.
+func (t *Templates) RenderFragmentWithStatus(w http.ResponseWriter, r *http.Request, status int, templateName, block string, data interface{}) error {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	}
+	w.Header().Add("Vary", "HX-Request")
 
-	tmpl, ok := t.templates[templateName]
+	format := t.ResolveOutputFormat(r)
+	key, _, err := t.resolveTemplateKey(templateName, r)
+	if err != nil {
+		return err
+	}
+	tmpl, ok := t.lookupForFormat(key, format)
 	if !ok {
 		return errors.New("template: name not found ->" + templateName)
 	}
-	return tmpl.ExecuteTemplate(w, "layout", data)
+
+	bw, alreadyBuffered := w.(*BufferedResponseWriter)
+	if alreadyBuffered {
+		return t.executeDynamic(tmpl, bw, r, block, data)
+	}
+
+	bw = t.NewBufferedResponseWriter(w)
+	if err := t.executeDynamic(tmpl, bw, r, block, data); err != nil {
+		bw.Release()
+		return err
+	}
+	return bw.Finish(t, r, status)
+}
+
+// turboStreamMediaType is the Accept header value Turbo uses to ask for a
+// multi-fragment response instead of a single rendered page.
+const turboStreamMediaType = "text/vnd.turbo-stream.html"
+
+// acceptsTurboStream reports whether r asked for a Turbo Stream response.
+func acceptsTurboStream(r *http.Request) bool {
+	return r != nil && strings.Contains(r.Header.Get("Accept"), turboStreamMediaType)
+}
+
+// RenderFragments renders several `{{define "block"}}` blocks from
+// templateName's page, one after another, for a protocol that wants to
+// update more than one part of a page in a single response. If r's Accept
+// header names turboStreamMediaType (Turbo's convention for this), each
+// block is wrapped as a `<turbo-stream action="replace" target="block">`
+// element and Content-Type is set to turboStreamMediaType; otherwise the
+// blocks are concatenated as plain HTML, in the order given, under
+// text/html (a good fit for Unpoly, which can already swap several targets
+// out of one response by matching element ids). Renders into a pooled
+// buffer first, same as RenderFragmentWithStatus, so a failure partway
+// through never leaves a partial body on the wire.
+func (t *Templates) RenderFragments(w http.ResponseWriter, r *http.Request, templateName string, blocks []string, data interface{}) error {
+	turboStream := acceptsTurboStream(r)
+	if turboStream {
+		w.Header().Set("Content-Type", turboStreamMediaType+"; charset=utf-8")
+	} else if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.Header().Add("Vary", "Accept")
+
+	format := t.ResolveOutputFormat(r)
+	key, _, err := t.resolveTemplateKey(templateName, r)
+	if err != nil {
+		return err
+	}
+	tmpl, ok := t.lookupForFormat(key, format)
+	if !ok {
+		return errors.New("template: name not found ->" + templateName)
+	}
+
+	bw, alreadyBuffered := w.(*BufferedResponseWriter)
+	if !alreadyBuffered {
+		bw = t.NewBufferedResponseWriter(w)
+	}
+
+	for _, block := range blocks {
+		if turboStream {
+			target := strings.TrimPrefix(block, "_")
+			if _, err := fmt.Fprintf(bw, `<turbo-stream action="replace" target=%q><template>`, target); err != nil {
+				if !alreadyBuffered {
+					bw.Release()
+				}
+				return err
+			}
+		}
+		if err := t.executeDynamic(tmpl, bw, r, block, data); err != nil {
+			if !alreadyBuffered {
+				bw.Release()
+			}
+			return err
+		}
+		if turboStream {
+			if _, err := bw.Write([]byte("</template></turbo-stream>")); err != nil {
+				if !alreadyBuffered {
+					bw.Release()
+				}
+				return err
+			}
+		}
+	}
+
+	if alreadyBuffered {
+		return nil
+	}
+	return bw.Finish(t, r, http.StatusOK)
+}
+
+// ExecuteFormat renders templateName as formatName, bypassing the content
+// negotiation ExecuteTemplate would otherwise run via ResolveOutputFormat
+// (context, URL extension, Accept header). Useful for a route that always
+// serves one format regardless of what the request asks for, e.g. a
+// "/feed.xml" handler that should render the "rss" OutputFormat even without
+// an Accept header or matching URL suffix.
+func (t *Templates) ExecuteFormat(w io.Writer, r *http.Request, templateName, formatName string, data interface{}) error {
+	if _, ok := t.OutputFormats[formatName]; !ok {
+		return fmt.Errorf("template: unknown output format %q", formatName)
+	}
+	req := r
+	if req == nil {
+		req = &http.Request{URL: &url.URL{}, Header: http.Header{}}
+	}
+	ctx := context.WithValue(req.Context(), OutputFormatContextKey{}, formatName)
+	return t.ExecuteTemplate(w, req.WithContext(ctx), templateName, data)
+}
+
+// ExecuteTemplateAs is ExecuteFormat, named after this package's
+// output-format-aware rendering was first proposed; the two are identical.
+func (t *Templates) ExecuteTemplateAs(w io.Writer, r *http.Request, templateName, formatName string, data interface{}) error {
+	return t.ExecuteFormat(w, r, templateName, formatName, data)
+}
+
+// SafeExecuteTemplate renders templateName into a pooled buffer (see
+// NewBufferedResponseWriter, bounded by MaxBufferSize) and only then writes
+// the status code, Content-Type/Content-Length (and ETag/compression, if
+// Compression is CompressionAuto) to w -- so a template error partway
+// through rendering never leaves a half-written 200 on the wire, unlike
+// ExecuteTemplate writing straight to w. On success it commits a 200; on
+// failure it calls ErrorHandler, or RenderError with a 500 if ErrorHandler
+// is nil, and returns the original error for the caller to log.
+//
+// This is the safe primitive HandlerRenderWithData and
+// HandlerRenderWithDataFromContext are built on; call it directly from a
+// handler that needs its own data.
+func (t *Templates) SafeExecuteTemplate(w http.ResponseWriter, r *http.Request, templateName string, data interface{}) error {
+	bw := t.NewBufferedResponseWriter(w)
+	if err := t.ExecuteTemplate(bw, r, templateName, data); err != nil {
+		bw.Release()
+		if t.ErrorHandler != nil {
+			t.ErrorHandler(w, r, err)
+		} else {
+			t.RenderError(w, r, http.StatusInternalServerError, err)
+		}
+		return err
+	}
+	return bw.Finish(t, r, http.StatusOK)
+}
+
+// ResolveOutputFormat determines which registered OutputFormat a request
+// should be rendered as. It checks, in order: an explicit format name stored
+// under OutputFormatContextKey in the request's context, the file-extension
+// suffix of the request's URL path (e.g. "/person.json"), and the Accept
+// header. It falls back to the "html" format (also when r is nil), and to
+// an empty OutputFormat if "html" isn't registered.
+func (t *Templates) ResolveOutputFormat(r *http.Request) OutputFormat {
+	if r != nil {
+		if name, ok := r.Context().Value(OutputFormatContextKey{}).(string); ok {
+			if format, ok := t.OutputFormats[name]; ok {
+				return format
+			}
+		}
+		if ext := strings.TrimPrefix(path.Ext(r.URL.Path), "."); ext != "" {
+			if format, ok := t.OutputFormats[ext]; ok {
+				return format
+			}
+		}
+		if accept := r.Header.Get("Accept"); accept != "" {
+			for _, format := range t.OutputFormats {
+				if format.MediaType != "" && strings.Contains(accept, format.MediaType) {
+					return format
+				}
+			}
+		}
+	}
+	return t.OutputFormats["html"]
+}
+
+// lookupForFormat resolves a "layout:page", ":page" or "page" template name
+// to a ParsedTemplate, preferring the format-specific variant (e.g.
+// "layout.json:page.json") when one was parsed, and falling back to the
+// plain name otherwise.
+func (t *Templates) lookupForFormat(templateName string, format OutputFormat) (ParsedTemplate, bool) {
+	if format.Suffix != "" {
+		suffixed := addFormatSuffix(templateName, format.Suffix)
+		if tmpl, ok := t.currentSet().templates[suffixed]; ok {
+			return tmpl, true
+		}
+	}
+	tmpl, ok := t.currentSet().templates[templateName]
+	return tmpl, ok
+}
+
+// addFormatSuffix appends ".suffix" to each non-empty "layout:page" segment
+// of templateName, e.g. ("application:person", "json") -> "application.json:person.json".
+func addFormatSuffix(templateName, suffix string) string {
+	parts := strings.SplitN(templateName, ":", 2)
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = part + "." + suffix
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// outputFormatForFile reports the OutputFormat a template file belongs to,
+// based on the format-suffix segment of its name (e.g. "products.json" in
+// "products.json.gohtml" selects the "json" format, per its Suffix), and
+// whether one was found.
+func (t *Templates) outputFormatForFile(filePath string) (OutputFormat, bool) {
+	filename := filepath.Base(filePath)
+	name := strings.TrimSuffix(filename, path.Ext(filename))
+	suffix := strings.TrimPrefix(path.Ext(name), ".")
+	if suffix == "" {
+		return OutputFormat{}, false
+	}
+	for _, format := range t.OutputFormats {
+		if format.Suffix == suffix {
+			return format, true
+		}
+	}
+	return OutputFormat{}, false
+}
+
+// engineForFile returns the Engine that should parse file, preferring an
+// IsPlainText OutputFormat's engine over the one its file extension would
+// otherwise select: "products.json.gohtml" is parsed by EngineText, not
+// EngineSafehtml, even though ".gohtml" on its own means EngineSafehtml --
+// safehtml/template's HTML-context escaping would otherwise corrupt JSON
+// output. A plain-text format shares the file extension (and directory) of
+// its HTML counterpart on purpose, following Hugo's output-format design:
+// only the "<page>.<suffix>" segment, not the file extension, marks a file
+// as belonging to one format or another.
+func (t *Templates) engineForFile(file templateFile) Engine {
+	if format, ok := t.outputFormatForFile(file.path); ok && format.IsPlainText {
+		return t.engineFor(EngineText)
+	}
+	return t.engineFor(file.kind)
+}
+
+// RenderError renders a themed error page for status, writing the status
+// code and falling back to a plain http.Error if no matching error template
+// is registered or if rendering it fails. Template resolution tries, in
+// order: "error_<status>" (e.g. "error_404"), "error_<class>xx" for the
+// status class (e.g. "error_4xx"), then the generic "error" page (the same
+// page ExecuteTemplate falls back to for an empty template name) -- override
+// that order with Templates.ErrorTemplateResolver. Normal layout resolution,
+// including LayoutContextKey, applies. See MustHaveErrorTemplates for an
+// opt-in startup check that one of these actually exists for a given status.
+//
+// The page is passed a map with "Status", "Error" and "Message" keys, plus
+// "RequestID" (from the request's "X-Request-Id" header, when present) and
+// "StackTrace" (when r's context carries one under StackTraceContextKey, as
+// Recoverer sets it), so error templates can render something like
+// `{{.Status}}: {{.Message}}`. See RenderErrorWithData to add more, e.g. a
+// trace ID pulled from tracing middleware.
+func (t *Templates) RenderError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	t.RenderErrorWithData(w, r, status, err, nil)
+}
+
+// RenderErrorWithData is RenderError, with extra merged into the data map
+// passed to the error template alongside "Status"/"Error"/"Message"/
+// "RequestID"/"StackTrace" -- e.g. a trace ID a tracing middleware stored on
+// r's context:
+//
+//	tmpls.RenderErrorWithData(w, r, status, err, map[string]any{"TraceID": traceID})
+func (t *Templates) RenderErrorWithData(w http.ResponseWriter, r *http.Request, status int, err error, extra map[string]any) {
+	msg := http.StatusText(status)
+	if err != nil {
+		msg = err.Error()
+	}
+	data := map[string]any{"Status": status, "Error": err, "Message": msg}
+	if r != nil {
+		if reqID := r.Header.Get("X-Request-Id"); reqID != "" {
+			data["RequestID"] = reqID
+		}
+		if stack, ok := r.Context().Value(StackTraceContextKey{}).(string); ok {
+			data["StackTrace"] = stack
+		}
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	for _, name := range t.errorTemplateCandidates(status) {
+		if !t.pageExists(name) {
+			continue
+		}
+		w.WriteHeader(status)
+		renderErr := t.ExecuteTemplate(w, r, name, data)
+		if renderErr == nil {
+			return
+		}
+		t.Logger.Error("failed to render error template", "template", name, "status", status, "error", renderErr)
+		break
+	}
+	http.Error(w, msg, status)
+}
+
+// errorTemplateCandidates returns t.ErrorTemplateResolver(status) if set,
+// else the default "error_<status>", "error_<class>xx", "error" order.
+func (t *Templates) errorTemplateCandidates(status int) []string {
+	if t.ErrorTemplateResolver != nil {
+		return t.ErrorTemplateResolver(status)
+	}
+	return []string{
+		fmt.Sprintf("error_%d", status),
+		fmt.Sprintf("error_%dxx", status/100),
+		"error",
+	}
+}
+
+// MustHaveErrorTemplates panics listing any status in statuses for which
+// none of t.errorTemplateCandidates(status) was parsed as a page -- an
+// opt-in startup check (call it after MustParseTemplates) for an app that
+// wants to fail fast on a missing error page instead of discovering it the
+// first time RenderError falls back to http.Error. No status is mandatory
+// by default; pass the ones your app relies on, e.g.
+// MustHaveErrorTemplates(http.StatusNotFound, http.StatusInternalServerError).
+func (t *Templates) MustHaveErrorTemplates(statuses ...int) {
+	var missing []int
+	for _, status := range statuses {
+		found := false
+		for _, name := range t.errorTemplateCandidates(status) {
+			if t.pageExists(name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, status)
+		}
+	}
+	if len(missing) > 0 {
+		panic(fmt.Sprintf("templates: MustHaveErrorTemplates: no error template resolved for status(es) %v", missing))
+	}
+}
+
+// pageExists reports whether pageName was parsed as a page, either standalone
+// (":pageName") or under any layout ("layout:pageName").
+func (t *Templates) pageExists(pageName string) bool {
+	if _, ok := t.currentSet().templates[":"+pageName]; ok {
+		return true
+	}
+	suffix := ":" + pageName
+	for key := range t.currentSet().templates {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// HaveTemplate reports whether name will resolve for ExecuteTemplate without
+// actually rendering it -- accepting the same "page", "layout:page",
+// ":page" and "_block" forms ExecuteTemplate does, with a bare "page"
+// resolved through the same section-layout lookup (LayoutLookup, from
+// DefaultLayout) ExecuteTemplate uses (it can't know a request's
+// LayoutContextKey override without one). Useful for a handler that wants
+// to probe for a template's existence and fall back to another name, e.g.
+// trying "foo" and falling back to "foo/index" only if the first doesn't
+// exist, without the expense and log noise of attempting a render first.
+func (t *Templates) HaveTemplate(name string) bool {
+	if strings.HasPrefix(name, "_") {
+		_, ok := t.currentSet().templates[name]
+		return ok
+	}
+	key, _, err := t.resolveTemplateKey(name, nil)
+	if err != nil {
+		return false
+	}
+	_, ok := t.currentSet().templates[key]
+	return ok
+}
+
+// TemplateNames is GetParsedTemplates under the name that pairs with
+// HaveTemplate.
+func (t *Templates) TemplateNames() []string {
+	return t.GetParsedTemplates()
 }
 
 // RenderBlockAsHTMLString renders a specific block to a safehtml.HTML string.
@@ -349,7 +1472,7 @@ func (t *Templates) RenderBlockAsHTMLString(blockname string, payload interface{
 		return safehtml.HTML{}, errors.New("number of characters in string must not exceed 255")
 	}
 	b := bytes.Buffer{}
-	tt, ok := t.templates[blockname]
+	tt, ok := t.currentSet().templates[blockname]
 	if !ok {
 		return safehtml.HTML{}, errors.New("template " + blockname + " not found in templates-map")
 	}
@@ -420,11 +1543,12 @@ func (t *Templates) AddReferencesToFuncMap() {
 	t.funcMap["references"] = References
 }
 
-// HandlerRenderWithData returns a http.HandlerFunc that renders a template with
-// the provided static data.
+// HandlerRenderWithData returns a http.HandlerFunc that renders a template
+// with the provided static data, via SafeExecuteTemplate so a render error
+// never leaves a partial response on the wire.
 func (t *Templates) HandlerRenderWithData(templateName string, data interface{}) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := t.ExecuteTemplate(w, r, templateName, data)
+		err := t.SafeExecuteTemplate(w, r, templateName, data)
 		if err != nil {
 			t.Logger.Error("failed to execute template", "error", err, "template_name", templateName)
 		}
@@ -432,29 +1556,51 @@ func (t *Templates) HandlerRenderWithData(templateName string, data interface{})
 }
 
 // HandlerRenderWithDataFromContext returns a http.HandlerFunc that renders a
-// template, taking its data from the request's context via the provided context key.
+// template, taking its data from the request's context via the provided
+// context key, via SafeExecuteTemplate so a render error never leaves a
+// partial response on the wire.
 func (t *Templates) HandlerRenderWithDataFromContext(templateName string, contextKey interface{}) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := t.ExecuteTemplate(w, r, templateName, r.Context().Value(contextKey))
+		err := t.SafeExecuteTemplate(w, r, templateName, r.Context().Value(contextKey))
 		if err != nil {
 			t.Logger.Error("failed to execute template", "error", err, "template_name", templateName)
 		}
 	}
 }
 
+// HandlerRenderWithDataForFormat is HandlerRenderWithData, forcing the
+// given OutputFormats name (e.g. "json", "rss") instead of negotiating one
+// via ResolveOutputFormat -- the content-negotiated counterpart is
+// HandlerRenderWithData itself, since SafeExecuteTemplate/ExecuteTemplate
+// already negotiate internally; use this when a route is dedicated to one
+// format regardless of what the request asks for, e.g. "/feed.xml" always
+// rendering "rss".
+func (t *Templates) HandlerRenderWithDataForFormat(templateName, formatName string, data interface{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), OutputFormatContextKey{}, formatName)
+		err := t.SafeExecuteTemplate(w, r.WithContext(ctx), templateName, data)
+		if err != nil {
+			t.Logger.Error("failed to execute template", "error", err, "template_name", templateName, "format", formatName)
+		}
+	}
+}
+
 // GetParsedTemplates returns a sorted slice of the names of all parsed templates.
 // This is primarily intended for debugging and testing purposes.
 func (t *Templates) GetParsedTemplates() []string {
-	keys := make([]string, 0, len(t.templates))
+	set := t.currentSet()
+	keys := make([]string, 0, len(set.templates))
 
-	for k := range t.templates {
+	for k := range set.templates {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
 	return keys
 }
 
-// ExecuteTemplateAsText is a testing helper that renders a template to a string.
+// ExecuteTemplateAsText renders a template to a string instead of a writer --
+// handy in tests asserting on output, but also used by production code (e.g.
+// chirender.SSE) that needs the rendered body in hand before framing it.
 func (t *Templates) ExecuteTemplateAsText(r *http.Request, templateName string, data interface{}) (string, error) {
 	b := &bytes.Buffer{}
 	err := t.ExecuteTemplate(b, r, templateName, data)
@@ -464,6 +1610,22 @@ func (t *Templates) ExecuteTemplateAsText(r *http.Request, templateName string,
 	return b.String(), nil
 }
 
+// ExecuteTextTemplate is ExecuteTemplate, named for discoverability alongside
+// ExecuteTemplateAsText/ExecuteTextTemplateAsText: ExecuteTemplate already
+// dispatches templateName to whichever Engine parsed it (EngineSafehtml for
+// a ".gohtml" file, EngineText -- plain text/template, unescaped -- for a
+// ".gotxt" one; see TemplateFileExtensions and TextEngine), so a CSV/JSON/
+// XML page authored as a ".gotxt" file needs no separate call.
+func (t *Templates) ExecuteTextTemplate(w io.Writer, r *http.Request, templateName string, data interface{}) error {
+	return t.ExecuteTemplate(w, r, templateName, data)
+}
+
+// ExecuteTextTemplateAsText is ExecuteTemplateAsText, named to pair with
+// ExecuteTextTemplate.
+func (t *Templates) ExecuteTextTemplateAsText(r *http.Request, templateName string, data interface{}) (string, error) {
+	return t.ExecuteTemplateAsText(r, templateName, data)
+}
+
 func trustedHTML(html any) safehtml.HTML {
 	if html == nil {
 		return uncheckedconversions.HTMLFromStringKnownToSatisfyTypeContract("")
@@ -567,7 +1729,48 @@ func (t *Templates) fatalOnErr(err error) {
 	}
 }
 
-func getFilePathsInDir(fs http.FileSystem, dirPath string, prefixTemplatesPath bool) ([]string, error) {
+// templateFile is one file discovered by getFilePathsInDir, tagged with the
+// EngineKind (per t.TemplateFileExtensions) that should parse it. relName is
+// its name relative to the dirPath it was found under, subdirectories
+// included and extension trimmed (e.g. "blog/post" for a file found by
+// getFilePathsInDirRecursive at "<dirPath>/blog/post.gohtml", "post" for one
+// directly inside dirPath) -- what ParseTemplates registers the layout, page
+// or block under, and what recordTemplateSource keys layer resolution by.
+type templateFile struct {
+	path    string
+	kind    EngineKind
+	relName string
+}
+
+// filePathsOfKind returns the paths of the files in files whose kind matches.
+// Used to restrict the blocks bundled into a parse call to the same Engine as
+// the layout/page they're being combined with.
+func filePathsOfKind(files []templateFile, kind EngineKind) []string {
+	var paths []string
+	for _, f := range files {
+		if f.kind == kind {
+			paths = append(paths, f.path)
+		}
+	}
+	return paths
+}
+
+// engineFor returns the Engine registered for kind: Engine itself for
+// EngineSafehtml (preserving the pluggable-Engine override from before
+// multiple engines existed), or the matching entry in Engines otherwise.
+func (t *Templates) engineFor(kind EngineKind) Engine {
+	if kind == EngineSafehtml {
+		return t.Engine
+	}
+	if e, ok := t.Engines[kind]; ok {
+		return e
+	}
+	return t.Engine
+}
+
+// getFilePathsInDir lists the files directly inside dirPath whose extension
+// is registered in t.TemplateFileExtensions, tagging each with its EngineKind.
+func (t *Templates) getFilePathsInDir(fs http.FileSystem, dirPath string, prefixTemplatesPath bool) ([]templateFile, error) {
 	dirPath = cleanPath(dirPath)
 	dir, err := fs.Open(dirPath)
 	if err != nil {
@@ -577,31 +1780,171 @@ func getFilePathsInDir(fs http.FileSystem, dirPath string, prefixTemplatesPath b
 	if err != nil {
 		return nil, fmt.Errorf("getFilePathsInDir Readdir: %w", err)
 	}
-	var files []string
+	var files []templateFile
 	for _, fileInfo := range fileInfos {
-		if path.Ext(fileInfo.Name()) == fileExtension {
+		kind, ok := t.TemplateFileExtensions[path.Ext(fileInfo.Name())]
+		if !ok {
+			continue
+		}
+		p := cleanPath(filepath.Join(dirPath, fileInfo.Name()))
+		if prefixTemplatesPath {
+			p = cleanPath(filepath.Join(t.root, dirPath, fileInfo.Name()))
+		}
+		relName := strings.TrimSuffix(fileInfo.Name(), path.Ext(fileInfo.Name()))
+		files = append(files, templateFile{path: p, kind: kind, relName: relName})
+	}
+	return files, nil
+}
+
+// getFilePathsInDirRecursive is getFilePathsInDir, but also descends into
+// subdirectories of dirPath -- e.g. "layouts/blog/app.gohtml" and
+// "pages/blog/post.gohtml" for section-scoped layouts (see
+// resolveSectionLayout) -- tagging each file's relName with its
+// subdirectory, forward-slash joined, relative to dirPath.
+func (t *Templates) getFilePathsInDirRecursive(fs http.FileSystem, dirPath string, prefixTemplatesPath bool) ([]templateFile, error) {
+	dirPath = cleanPath(dirPath)
+	var files []templateFile
+	var walk func(sub string) error
+	walk = func(sub string) error {
+		dir, err := fs.Open(cleanPath(path.Join(dirPath, sub)))
+		if err != nil {
+			return fmt.Errorf("getFilePathsInDirRecursive fs.Open: %w", err)
+		}
+		fileInfos, err := dir.Readdir(-1)
+		dir.Close()
+		if err != nil {
+			return fmt.Errorf("getFilePathsInDirRecursive Readdir: %w", err)
+		}
+		for _, fileInfo := range fileInfos {
+			relPath := path.Join(sub, fileInfo.Name())
+			if fileInfo.IsDir() {
+				if err := walk(relPath); err != nil {
+					return err
+				}
+				continue
+			}
+			kind, ok := t.TemplateFileExtensions[path.Ext(fileInfo.Name())]
+			if !ok {
+				continue
+			}
+			p := cleanPath(filepath.Join(dirPath, relPath))
 			if prefixTemplatesPath {
-				files = append(files, cleanPath(filepath.Join(templatesPath, dirPath, fileInfo.Name())))
-			} else {
-				files = append(files, cleanPath(filepath.Join(dirPath, fileInfo.Name())))
+				p = cleanPath(filepath.Join(t.root, dirPath, relPath))
 			}
+			relName := strings.TrimSuffix(relPath, path.Ext(relPath))
+			files = append(files, templateFile{path: p, kind: kind, relName: relName})
 		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
 	}
 	return files, nil
 }
 
-func parseNewTemplateWithFuncMap(layout string, fnMap template.FuncMap, fs template.TrustedFS, files ...string) (*template.Template, error) {
-	if len(files) == 0 {
-		return nil, errors.New("no files in slice")
+// templateSource records which layer a resolveLayeredDir file came from, for
+// TemplateSource to report back.
+type templateSource struct {
+	layerIndex int
+	path       string
+}
+
+// parsedSet is the immutable result of one ParseTemplates run: the compiled
+// templates and where each one came from (see TemplateSource). t.current
+// holds a *parsedSet behind an atomic.Pointer so ExecuteTemplate and friends
+// read it without ever taking a lock -- WatchAndReload (or
+// AlwaysReloadAndParseTemplates) swaps in a new parsedSet built entirely off
+// to the side, and any render already in flight keeps using the one it
+// loaded, never a half-built one.
+type parsedSet struct {
+	templates map[string]ParsedTemplate
+	sources   map[string]templateSource
+}
+
+// currentSet returns the most recently parsed set, or an empty one if
+// ParseTemplates hasn't run yet.
+func (t *Templates) currentSet() *parsedSet {
+	if s := t.current.Load(); s != nil {
+		return s
 	}
-	t := template.New(layout).Funcs(fnMap)
+	return &parsedSet{}
+}
 
-	t, err := t.ParseFS(fs, files...)
-	if err != nil {
+// resolveLayeredDir returns the template files for dirName (one of
+// t.LayoutsPath, t.PagesPath, t.BlocksPath): the overlay's copy of each
+// relName if Templates.AddOverlay was called, else the project's own copy,
+// plus, for any relName neither has, the first layer in t.Layers that
+// provides it -- the file-level "first hit wins" override Layers describes,
+// except overlay wins over the project instead of the other way round. A
+// layer missing dirName entirely (e.g. a theme with no blocks of its own) is
+// skipped rather than treated as an error. recursive additionally descends
+// into subdirectories of dirName (and of each layer's copy of it), for
+// section-scoped layouts/pages -- see getFilePathsInDirRecursive.
+func (t *Templates) resolveLayeredDir(hfs http.FileSystem, dirName string, sources map[string]templateSource, recursive bool) ([]templateFile, error) {
+	list := t.getFilePathsInDir
+	if recursive {
+		list = t.getFilePathsInDirRecursive
+	}
+
+	var files []templateFile
+	seen := make(map[string]bool)
+	if t.overlayFileSystem != nil {
+		overlayFiles, err := list(http.FS(t.overlayFileSystem), dirName, t.overlayFileSystemIsEmbed)
+		if err == nil {
+			for _, f := range overlayFiles {
+				seen[f.relName] = true
+				files = append(files, f)
+				recordTemplateSource(sources, f, 0)
+			}
+		}
+	}
+
+	baseFiles, err := list(hfs, dirName, t.fileSystemIsEmbed)
+	if err != nil && len(files) == 0 {
 		return nil, err
 	}
+	for _, f := range baseFiles {
+		if seen[f.relName] {
+			continue
+		}
+		seen[f.relName] = true
+		files = append(files, f)
+		recordTemplateSource(sources, f, 0)
+	}
+	for i, layer := range t.Layers {
+		layerFiles, err := list(hfs, path.Join(layer, dirName), t.fileSystemIsEmbed)
+		if err != nil {
+			continue
+		}
+		for _, f := range layerFiles {
+			if seen[f.relName] {
+				continue
+			}
+			seen[f.relName] = true
+			files = append(files, f)
+			recordTemplateSource(sources, f, i+1)
+		}
+	}
+	return files, nil
+}
+
+func recordTemplateSource(sources map[string]templateSource, f templateFile, layerIndex int) {
+	sources[f.relName] = templateSource{layerIndex: layerIndex, path: f.path}
+}
 
-	return t, nil
+// TemplateSource reports which layer a parsed layout, page or block named
+// name actually came from: layerIndex 0 means the project's own
+// LayoutsPath/PagesPath/BlocksPath, and n>0 means t.Layers[n-1]. It returns
+// (-1, "") if name wasn't resolved from either -- it doesn't exist, or
+// ParseTemplates hasn't run yet. If a layout, a page and a block happen to
+// share the same base filename, only the most recently parsed of the three
+// is reported, since they're tracked by filename alone.
+func (t *Templates) TemplateSource(name string) (layerIndex int, path string) {
+	src, ok := t.currentSet().sources[name]
+	if !ok {
+		return -1, ""
+	}
+	return src.layerIndex, src.path
 }
 
 // cleanPath returns the canonical path for p, eliminating . and .. elements.
@@ -332,6 +332,15 @@ func TestRendering(t *testing.T) {
 					if !strings.Contains(logBuf.String(), "failed to execute template") {
 						t.Error("Expected log message on handler error")
 					}
+					// SafeExecuteTemplate buffers the render, so a failure never
+					// leaves a partial 200 on the wire: the client gets a clean
+					// 500 and an error body instead.
+					if w.Code != http.StatusInternalServerError {
+						t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+					}
+					if w.Body.Len() == 0 {
+						t.Error("expected a non-empty error body")
+					}
 				})
 
 				t.Run("HandlerRenderWithDataFromContext", func(t *testing.T) {
@@ -345,6 +354,12 @@ func TestRendering(t *testing.T) {
 					if !strings.Contains(logBuf.String(), "failed to execute template") {
 						t.Error("Expected log message on handler error")
 					}
+					if w.Code != http.StatusInternalServerError {
+						t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+					}
+					if w.Body.Len() == 0 {
+						t.Error("expected a non-empty error body")
+					}
 				})
 			})
 		})
@@ -479,6 +494,12 @@ func TestErrorsAndPanics(t *testing.T) {
 		if err == nil {
 			t.Fatal("Expected a syntax error during parsing, but got nil")
 		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Kind != ParseErrorSyntax {
+			t.Errorf("Expected a ParseErrorSyntax ParseError, but got: %v", err)
+		} else if pe.Line == 0 {
+			t.Errorf("Expected the parser's error to carry a Line, but got %+v", pe)
+		}
 	})
 
 	t.Run("ExecuteTemplate_ReloadError", func(t *testing.T) {
@@ -539,7 +560,6 @@ func TestErrorsAndPanics(t *testing.T) {
 	t.Run("RenderBlockAsHTMLString_ExecutionError", func(t *testing.T) {
 		tmpls := New(nil, nil)
 		tmpls.funcMap = template.FuncMap{} // Ensure no unexpected funcs
-		tmpls.templates = make(map[string]*template.Template)
 
 		// Create a block that will fail on execution (indexing a nil map)
 		// but is valid at parse time.
@@ -547,7 +567,9 @@ func TestErrorsAndPanics(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Failed to parse bad block template: %v", err)
 		}
-		tmpls.templates["_bad_block"] = tpl
+		tmpls.current.Store(&parsedSet{templates: map[string]ParsedTemplate{
+			"_bad_block": &safehtmlParsedTemplate{t: tpl},
+		}})
 
 		_, err = tmpls.RenderBlockAsHTMLString("_bad_block", nil)
 		if err == nil {
@@ -749,6 +771,10 @@ func TestParseTemplatesErrors(t *testing.T) {
 		if err == nil || !strings.Contains(err.Error(), "no such file or directory") {
 			t.Errorf("Expected an error for missing layouts folder, but got: %v", err)
 		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Kind != ParseErrorIO {
+			t.Errorf("Expected a ParseErrorIO ParseError, but got: %v", err)
+		}
 	})
 
 	t.Run("no layouts in layouts folder", func(t *testing.T) {
@@ -768,6 +794,10 @@ func TestParseTemplatesErrors(t *testing.T) {
 		if err == nil || err.Error() != "you need at least one layout" {
 			t.Errorf("Expected error for no layouts, but got: %v", err)
 		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Kind != ParseErrorMissingLayouts {
+			t.Errorf("Expected a ParseErrorMissingLayouts ParseError, but got: %v", err)
+		}
 	})
 
 	t.Run("block name mismatch", func(t *testing.T) {
@@ -793,6 +823,10 @@ func TestParseTemplatesErrors(t *testing.T) {
 		if err == nil || !strings.Contains(err.Error(), "filename doesn't match a definition") {
 			t.Errorf("Expected block name mismatch error, but got: %v", err)
 		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Kind != ParseErrorBlockNameMismatch {
+			t.Errorf("Expected a ParseErrorBlockNameMismatch ParseError, but got: %v", err)
+		}
 	})
 
 	t.Run("duplicate block definition", func(t *testing.T) {
@@ -823,6 +857,10 @@ func TestParseTemplatesErrors(t *testing.T) {
 		if err == nil || !strings.Contains(err.Error(), "block already defined as key") {
 			t.Errorf("Expected 'block already defined' error, but got: %v", err)
 		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Kind != ParseErrorDuplicateBlock {
+			t.Errorf("Expected a ParseErrorDuplicateBlock ParseError, but got: %v", err)
+		}
 	})
 
 	t.Run("getFilePathsInDir readdir error", func(t *testing.T) {
@@ -1038,6 +1076,471 @@ func Test_NewWithRoot_Embed(t *testing.T) {
 	}
 }
 
+func Test_Layered(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "layered_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Project: its own layout, plus an override of one of the theme's pages.
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}[{{block "page" .}}{{end}}]{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "hello.gohtml", `{{define "page"}}Project Hello {{.}}{{end}}`)
+
+	// Theme layer: a page the project doesn't have, plus one it overrides.
+	themeDir := filepath.Join(tmpDir, "themes", "marketing")
+	mustWrite(filepath.Join(themeDir, "pages"), "pricing.gohtml", `{{define "page"}}Theme Pricing{{end}}`)
+	mustWrite(filepath.Join(themeDir, "pages"), "hello.gohtml", `{{define "page"}}Theme Hello {{.}}{{end}}`)
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.Layers = []string{"themes/marketing"}
+	tmpls.MustParseTemplates()
+
+	res, err := tmpls.ExecuteTemplateAsText(nil, "application:pricing", nil)
+	if err != nil {
+		t.Fatalf("Failed to execute layer-only page: %v", err)
+	}
+	if want := "[Theme Pricing]"; res != want {
+		t.Errorf("expected %q, got %q", want, res)
+	}
+
+	res, err = tmpls.ExecuteTemplateAsText(nil, "application:hello", "World")
+	if err != nil {
+		t.Fatalf("Failed to execute overridden page: %v", err)
+	}
+	if want := "[Project Hello World]"; res != want {
+		t.Errorf("the project's own page should win over the layer, got %q", res)
+	}
+
+	if layerIndex, path := tmpls.TemplateSource("pricing"); layerIndex != 1 || !strings.Contains(path, "themes/marketing") {
+		t.Errorf("expected pricing to resolve from layer 1, got layerIndex=%d path=%q", layerIndex, path)
+	}
+	if layerIndex, _ := tmpls.TemplateSource("hello"); layerIndex != 0 {
+		t.Errorf("expected the project's own hello to resolve as layer 0, got %d", layerIndex)
+	}
+	if layerIndex, _ := tmpls.TemplateSource("does-not-exist"); layerIndex != -1 {
+		t.Errorf("expected an unresolved name to report layerIndex -1, got %d", layerIndex)
+	}
+}
+
+// Test_Overlay_OverridesEmbedded exercises NewWithOverlay's primary use
+// case: ship default templates in an embed.FS, then let a pages/hello.gohtml
+// on disk override the embedded one without forking the rest of the set.
+func Test_Overlay_OverridesEmbedded(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "overlay_templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll("files/templates/pages", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("files/templates/pages", "hello.gohtml"), []byte(`{{define "page"}}Overlay Hello {{.}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithOverlay(&embededTemplates, nil, nil, "files/templates")
+	tmpls.MustParseTemplates()
+
+	res, err := tmpls.ExecuteTemplateAsText(nil, "hello", "World")
+	if err != nil {
+		t.Fatalf("Failed to execute overlay-overridden page: %v", err)
+	}
+	if !strings.Contains(res, "Overlay Hello World") {
+		t.Errorf("expected the overlay's pages/hello.gohtml to win over the embedded one, got %q", res)
+	}
+}
+
+// Test_Overlay_BlockMismatchError confirms the block name mismatch check
+// (see TestParseTemplatesErrors' "block name mismatch" case) still fires
+// against a block file the overlay introduces, not just ones from the base
+// filesystem.
+func Test_Overlay_BlockMismatchError(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "overlay_block_mismatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll("files/templates/blocks", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join("files/templates/blocks", "mismatch.gohtml"), []byte(`{{define "_actual"}}...{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithOverlay(&embededTemplates, nil, nil, "files/templates")
+	err = tmpls.ParseTemplates()
+	if err == nil || !strings.Contains(err.Error(), "filename doesn't match a definition") {
+		t.Errorf("expected a block name mismatch error from the overlay's block file, but got: %v", err)
+	}
+}
+
+func Test_SectionScopedLayouts(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "section_layouts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}Default[{{block "page" .}}{{end}}]{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "layouts", "blog"), "application.gohtml", `{{define "layout"}}Blog[{{block "page" .}}{{end}}]{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages", "blog"), "post.gohtml", `{{define "page"}}Post {{.}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages", "blog"), "archive.gohtml", `{{define "page"}}Archive{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "hello.gohtml", `{{define "page"}}Hello {{.}}{{end}}`)
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+
+	// A page in a section whose layout exists picks it up without an
+	// explicit "layout:page" name.
+	res, err := tmpls.ExecuteTemplateAsText(nil, "blog/post", "World")
+	if err != nil {
+		t.Fatalf("Failed to execute section-scoped page: %v", err)
+	}
+	if want := "Blog[Post World]"; res != want {
+		t.Errorf("expected %q, got %q", want, res)
+	}
+
+	// A top-level page still falls back to DefaultLayout.
+	res, err = tmpls.ExecuteTemplateAsText(nil, "hello", "World")
+	if err != nil {
+		t.Fatalf("Failed to execute top-level page: %v", err)
+	}
+	if want := "Default[Hello World]"; res != want {
+		t.Errorf("expected %q, got %q", want, res)
+	}
+
+	// The explicit "layout:page" form still works and can cross sections.
+	res, err = tmpls.ExecuteTemplateAsText(nil, "application:blog/archive", nil)
+	if err != nil {
+		t.Fatalf("Failed to execute explicit layout:page form: %v", err)
+	}
+	if want := "Default[Archive]"; res != want {
+		t.Errorf("expected %q, got %q", want, res)
+	}
+}
+
+func Test_SectionScopedLayouts_Fallback(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "section_layouts_fallback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// No blog-specific layout: "blog/post" must fall back to the plain
+	// "application" layout.
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}Default[{{block "page" .}}{{end}}]{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages", "blog"), "post.gohtml", `{{define "page"}}Post {{.}}{{end}}`)
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+
+	res, err := tmpls.ExecuteTemplateAsText(nil, "blog/post", "World")
+	if err != nil {
+		t.Fatalf("Failed to fall back to the default layout: %v", err)
+	}
+	if want := "Default[Post World]"; res != want {
+		t.Errorf("expected %q, got %q", want, res)
+	}
+}
+
+func Test_SectionScopedLayouts_NoneFound(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "section_layouts_none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A layout exists, but under a name resolveSectionLayout never tries,
+	// so "blog/post" has no candidate that was actually parsed.
+	mustWrite(filepath.Join(tmpDir, "layouts"), "other.gohtml", `{{define "layout"}}{{block "page" .}}{{end}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages", "blog"), "post.gohtml", `{{define "page"}}Post{{end}}`)
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.DefaultLayout = "application"
+	tmpls.MustParseTemplates()
+
+	_, err = tmpls.ExecuteTemplateAsText(nil, "blog/post", nil)
+	if err == nil || !strings.Contains(err.Error(), "no layout found for page") {
+		t.Errorf("expected a no-layout-found error, got: %v", err)
+	}
+}
+
+func Test_SectionScopedLayouts_CustomLookup(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "section_layouts_custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustWrite(filepath.Join(tmpDir, "layouts"), "special.gohtml", `{{define "layout"}}Special[{{block "page" .}}{{end}}]{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages", "blog"), "post.gohtml", `{{define "page"}}Post{{end}}`)
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.LayoutLookup = func(pageDir, defaultLayout string) []string {
+		return []string{"special"}
+	}
+	tmpls.MustParseTemplates()
+
+	res, err := tmpls.ExecuteTemplateAsText(nil, "blog/post", nil)
+	if err != nil {
+		t.Fatalf("Failed to execute with a custom LayoutLookup: %v", err)
+	}
+	if want := "Special[Post]"; res != want {
+		t.Errorf("expected %q, got %q", want, res)
+	}
+}
+
+func Test_RegisterFuncsFor(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "perpage_funcs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}{{block "page" .}}{{end}}{{end}}`)
+	// Both pages call a function named "greeting" -- without a per-page
+	// override this would collide in the global funcMap.
+	mustWrite(filepath.Join(tmpDir, "pages"), "en.gohtml", `{{define "page"}}{{greeting}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "fr.gohtml", `{{define "page"}}{{greeting}}{{end}}`)
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.RegisterFuncsFor("en", template.FuncMap{"greeting": func() string { return "Hello" }})
+	tmpls.RegisterFuncsFor("fr", template.FuncMap{"greeting": func() string { return "Bonjour" }})
+	tmpls.MustParseTemplates()
+
+	res, err := tmpls.ExecuteTemplateAsText(nil, "application:en", nil)
+	if err != nil {
+		t.Fatalf("Failed to execute en page: %v", err)
+	}
+	if res != "Hello" {
+		t.Errorf("expected %q, got %q", "Hello", res)
+	}
+
+	res, err = tmpls.ExecuteTemplateAsText(nil, "application:fr", nil)
+	if err != nil {
+		t.Fatalf("Failed to execute fr page: %v", err)
+	}
+	if res != "Bonjour" {
+		t.Errorf("expected %q, got %q", "Bonjour", res)
+	}
+}
+
+func Test_RenderFragments(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "render_fragments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}[{{block "page" .}}{{end}}]{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "dashboard.gohtml", `{{define "page"}}{{block "_header" .}}{{end}}{{block "_body" .}}{{end}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "blocks"), "header.gohtml", `{{define "_header"}}Header:{{.}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "blocks"), "body.gohtml", `{{define "_body"}}Body:{{.}}{{end}}`)
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+
+	t.Run("plain HTML", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		w := httptest.NewRecorder()
+
+		err := tmpls.RenderFragments(w, req, "application:dashboard", []string{"_header", "_body"}, "x")
+		if err != nil {
+			t.Fatalf("RenderFragments: %v", err)
+		}
+		if got, want := w.Body.String(), "Header:xBody:x"; got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("expected text/html Content-Type, got %q", ct)
+		}
+	})
+
+	t.Run("turbo stream", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", turboStreamMediaType)
+		w := httptest.NewRecorder()
+
+		err := tmpls.RenderFragments(w, req, "application:dashboard", []string{"_header", "_body"}, "x")
+		if err != nil {
+			t.Fatalf("RenderFragments: %v", err)
+		}
+		want := `<turbo-stream action="replace" target="header"><template>Header:x</template></turbo-stream>` +
+			`<turbo-stream action="replace" target="body"><template>Body:x</template></turbo-stream>`
+		if got := w.Body.String(); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != turboStreamMediaType+"; charset=utf-8" {
+			t.Errorf("expected turbo-stream Content-Type, got %q", ct)
+		}
+	})
+}
+
+func Test_ExecuteTemplate_UnpolyFragment(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "unpoly_fragment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}[{{block "page" .}}{{end}}]{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "hello.gohtml", `{{define "page"}}Hello {{.}}{{end}}`)
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Up-Target", "#hello")
+	w := httptest.NewRecorder()
+
+	if err := tmpls.ExecuteTemplate(w, req, "hello", "World"); err != nil {
+		t.Fatalf("ExecuteTemplate: %v", err)
+	}
+	if got, want := w.Body.String(), "Hello World"; got != want {
+		t.Errorf("expected the layout to be skipped for an Unpoly fragment request, got %q want %q", got, want)
+	}
+	if vary := w.Header().Values("Vary"); !containsAll(vary, "HX-Request", "X-Up-Target") {
+		t.Errorf("expected Vary to list HX-Request and X-Up-Target, got %v", vary)
+	}
+}
+
+func containsAll(haystack []string, wants ...string) bool {
+	for _, want := range wants {
+		found := false
+		for _, h := range haystack {
+			if h == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_HaveTemplate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "have_template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mustWrite := func(dir, name, content string) {
+		os.MkdirAll(dir, 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustWrite(filepath.Join(tmpDir, "layouts"), "application.gohtml", `{{define "layout"}}{{block "page" .}}{{end}}{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "pages"), "hello.gohtml", `{{define "page"}}Hello{{end}}`)
+	mustWrite(filepath.Join(tmpDir, "blocks"), "greeting.gohtml", `{{define "_greeting"}}Hi{{end}}`)
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.MustParseTemplates()
+
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{"hello", true},
+		{"application:hello", true},
+		{":hello", true},
+		{"_greeting", true},
+		{"hello/index", false},
+		{"does-not-exist", false},
+	}
+	for _, c := range cases {
+		if got := tmpls.HaveTemplate(c.name); got != c.want {
+			t.Errorf("HaveTemplate(%q) = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	names := tmpls.TemplateNames()
+	if len(names) != len(tmpls.GetParsedTemplates()) {
+		t.Errorf("expected TemplateNames to mirror GetParsedTemplates, got %v", names)
+	}
+}
+
 func Test_Concurrency(t *testing.T) {
 	// Setup custom templates for concurrency test
 	tmpDir, err := ioutil.TempDir("", "concurrency_test")
@@ -0,0 +1,145 @@
+package templates
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"text/template"
+	"text/template/parse"
+)
+
+// EngineKind identifies one of the template engines registered on a
+// Templates instance, for the purpose of mapping a file extension (via
+// Templates.TemplateFileExtensions) to the Engine that should parse it.
+type EngineKind string
+
+const (
+	// EngineSafehtml is the kind backing Templates.Engine and the default
+	// ".gohtml" extension. Files of this kind are parsed with
+	// google/safehtml/template.
+	EngineSafehtml EngineKind = "safehtml"
+
+	// EngineText is the kind backing TextEngine. Files of this kind are
+	// parsed with the stdlib text/template, for output that isn't HTML and
+	// so doesn't need safehtml's context-aware escaping.
+	EngineText EngineKind = "text"
+)
+
+// DefaultTemplateFileExtensions is the extension-to-engine mapping Templates
+// starts with: only ".gohtml", mapped to EngineSafehtml.
+var DefaultTemplateFileExtensions = map[string]EngineKind{
+	fileExtension: EngineSafehtml,
+}
+
+// TextEngine is an Engine backed by the stdlib text/template. It's the
+// counterpart to SafehtmlEngine for output that isn't HTML -- JSON, CSV,
+// XML/RSS, robots.txt, email bodies -- and so doesn't need safehtml's
+// context-aware escaping. Register it against a file extension via
+// Templates.TemplateFileExtensions/Templates.Engines (done by default for
+// EngineText) to parse pages with that extension through it.
+type TextEngine struct {
+	fs fs.FS
+
+	overlay    fs.FS
+	hasOverlay bool
+}
+
+// NewTextEngine constructs a TextEngine that reads template files from the
+// given filesystem.
+func NewTextEngine(fsys fs.FS) *TextEngine {
+	return &TextEngine{fs: fsys}
+}
+
+// SetOverlay makes ParseFiles prefer overlay over the base filesystem for
+// any file overlay has at the same path. See Templates.AddOverlay, the only
+// caller.
+func (e *TextEngine) SetOverlay(overlay fs.FS) {
+	e.overlay = overlay
+	e.hasOverlay = true
+}
+
+// ParseFiles implements Engine.
+func (e *TextEngine) ParseFiles(fnMap map[string]any, files ...string) (ParsedTemplate, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files in slice")
+	}
+	t := template.New("").Funcs(template.FuncMap(fnMap))
+
+	baseFiles, overlayFiles := files, []string(nil)
+	if e.hasOverlay {
+		baseFiles, overlayFiles = nil, nil
+		for _, f := range files {
+			if _, err := fs.Stat(e.overlay, f); err == nil {
+				overlayFiles = append(overlayFiles, f)
+			} else {
+				baseFiles = append(baseFiles, f)
+			}
+		}
+	}
+
+	var err error
+	if len(baseFiles) > 0 {
+		if t, err = t.ParseFS(e.fs, baseFiles...); err != nil {
+			return nil, err
+		}
+	}
+	if len(overlayFiles) > 0 {
+		if t, err = t.ParseFS(e.overlay, overlayFiles...); err != nil {
+			return nil, err
+		}
+	}
+	return &textParsedTemplate{t: t}, nil
+}
+
+// textParsedTemplate adapts *text/template.Template to ParsedTemplate.
+type textParsedTemplate struct {
+	t *template.Template
+}
+
+func (p *textParsedTemplate) ExecuteTemplate(w io.Writer, name string, data any) error {
+	return p.t.ExecuteTemplate(w, name, data)
+}
+
+func (p *textParsedTemplate) DefinedTemplates() []string {
+	var names []string
+	for _, tmpl := range p.t.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root.Pos == 0 {
+			continue
+		}
+		names = append(names, tmpl.Name())
+	}
+	return names
+}
+
+// Clone implements dynamicFuncPatcher, for RegisterDynamicFunc's pool of
+// per-execution clones.
+func (p *textParsedTemplate) Clone() (ParsedTemplate, error) {
+	t, err := p.t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &textParsedTemplate{t: t}, nil
+}
+
+// Funcs implements dynamicFuncPatcher, merging fnMap into this clone's
+// function map in place. Safe only because RegisterDynamicFunc's pool
+// guarantees exclusive ownership of the clone for the duration of one
+// execution.
+func (p *textParsedTemplate) Funcs(fnMap map[string]any) error {
+	p.t.Funcs(template.FuncMap(fnMap))
+	return nil
+}
+
+// Trees exposes the parse trees of every named template in this set, keyed
+// by name, so CheckTemplate's static type checking (typecheck.go) works the
+// same way it does for SafehtmlEngine.
+func (p *textParsedTemplate) Trees() map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree, len(p.t.Templates()))
+	for _, tmpl := range p.t.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		trees[tmpl.Name()] = tmpl.Tree
+	}
+	return trees
+}
@@ -0,0 +1,44 @@
+package templates
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ExecuteTextTemplate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "text_engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	layoutsDir := filepath.Join(tmpDir, "layouts")
+	pagesDir := filepath.Join(tmpDir, "pages")
+	os.MkdirAll(layoutsDir, 0755)
+	os.MkdirAll(pagesDir, 0755)
+
+	if err := ioutil.WriteFile(filepath.Join(layoutsDir, "application.gohtml"), []byte(`{{define "layout"}}{{block "page" .}}{{end}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(pagesDir, "sitemap.xml.gotxt"), []byte(`{{define "page"}}<url>{{.Value}}</url>{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpls := NewWithRoot(nil, nil, tmpDir)
+	tmpls.TemplateFileExtensions = map[string]EngineKind{
+		".gohtml": EngineSafehtml,
+		".gotxt":  EngineText,
+	}
+	tmpls.MustParseTemplates()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	res, err := tmpls.ExecuteTextTemplateAsText(r, ":sitemap.xml", map[string]any{"Value": "<entry>"})
+	failOnErr(t, err)
+
+	if want := "<url><entry></url>"; res != want {
+		t.Errorf("expected text/template output to stay unescaped, got %q", res)
+	}
+}
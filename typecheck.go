@@ -0,0 +1,186 @@
+package templates
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template/parse"
+)
+
+// CheckTemplate registers the Go type that the data argument for pageName
+// must satisfy. ParseTemplates (and therefore MustParseTemplates) will walk
+// every "layout"/"page" template parsed for pageName and verify that each
+// field or method it references on "." actually exists on typ, reporting the
+// template name and offending action if not. This turns typos like
+// `{{.Nmae}}` into a startup-time panic instead of a silent empty render on
+// first request.
+//
+// typ is typically a nil pointer to the data struct, e.g.
+// tmpls.CheckTemplate("person", (*Person)(nil)).
+//
+// Note: this is a safehtml-native equivalent of github.com/jba/templatecheck.
+// That package type-checks against the stdlib html/template.Template, which
+// safehtml/template deliberately does not expose (it would allow bypassing
+// the library's escaping guarantees), so we walk the parse tree that
+// safehtml/template.Template does expose via its Tree field instead. As a
+// result it only catches direct field/method references on "."; it does not
+// follow "with"/"range" into the new dot or type-check function arguments.
+func (t *Templates) CheckTemplate(pageName string, typ interface{}) {
+	if t.typeChecks == nil {
+		t.typeChecks = map[string]reflect.Type{}
+	}
+	t.typeChecks[pageName] = reflect.TypeOf(typ)
+}
+
+// treeProvider is implemented by ParsedTemplate values whose engine can
+// expose the parse trees of its named templates, e.g. *safehtmlParsedTemplate.
+// checkRegisteredTypes silently skips templates parsed by an Engine that
+// doesn't implement this, since static checking is inherently tied to Go's
+// text/template parse tree.
+type treeProvider interface {
+	Trees() map[string]*parse.Tree
+}
+
+// checkRegisteredTypes runs every check registered via CheckTemplate against
+// the template set ParseTemplates just built (not yet t.templates -- it's
+// still being validated). It is called once at the end of ParseTemplates so
+// broken templates are reported at startup, before the new set replaces the
+// live one.
+func (t *Templates) checkRegisteredTypes(templates map[string]ParsedTemplate) error {
+	for pageName, typ := range t.typeChecks {
+		found := false
+		for key, tmpl := range templates {
+			if key != pageName && !strings.HasSuffix(key, ":"+pageName) {
+				continue
+			}
+			found = true
+			provider, ok := tmpl.(treeProvider)
+			if !ok {
+				continue // current Engine can't expose parse trees; nothing to check
+			}
+			for name, tree := range provider.Trees() {
+				if err := checkTreeAgainstType(tree, typ, key+"#"+name); err != nil {
+					return err
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("CheckTemplate: no parsed template found for page %q", pageName)
+		}
+	}
+	return nil
+}
+
+func checkTreeAgainstType(tree *parse.Tree, typ reflect.Type, label string) error {
+	if tree == nil {
+		return nil
+	}
+	return checkNodeAgainstType(tree.Root, typ, label)
+}
+
+func checkNodeAgainstType(node parse.Node, typ reflect.Type, label string) error {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			if err := checkNodeAgainstType(c, typ, label); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkPipeAgainstType(n.Pipe, typ, label)
+	case *parse.IfNode:
+		if err := checkPipeAgainstType(n.Pipe, typ, label); err != nil {
+			return err
+		}
+		if err := checkNodeAgainstType(n.List, typ, label); err != nil {
+			return err
+		}
+		return checkNodeAgainstType(n.ElseList, typ, label)
+	case *parse.WithNode:
+		return checkPipeAgainstType(n.Pipe, typ, label) // dot changes inside; we don't descend
+	case *parse.RangeNode:
+		if err := checkPipeAgainstType(n.Pipe, typ, label); err != nil {
+			return err
+		}
+		return nil // dot changes to the range element; we don't descend
+	case *parse.TemplateNode:
+		return checkPipeAgainstType(n.Pipe, typ, label)
+	}
+	return nil
+}
+
+func checkPipeAgainstType(pipe *parse.PipeNode, typ reflect.Type, label string) error {
+	if pipe == nil {
+		return nil
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			field, ok := arg.(*parse.FieldNode)
+			if !ok {
+				continue
+			}
+			if err := checkFieldPath(field, typ, label); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkFieldPath(field *parse.FieldNode, typ reflect.Type, label string) error {
+	cur := typ
+	for _, ident := range field.Ident {
+		if cur == nil {
+			return nil // lost track of the type (e.g. interface{}); nothing more we can check
+		}
+		// Methods are checked on both the value and pointer method sets
+		// before unwrapping, since struct fields are addressable at render
+		// time even though reflect.Type alone doesn't know that.
+		if m, ok := cur.MethodByName(ident); ok {
+			cur = methodResultType(m)
+			continue
+		}
+		if cur.Kind() != reflect.Ptr {
+			if m, ok := reflect.PointerTo(cur).MethodByName(ident); ok {
+				cur = methodResultType(m)
+				continue
+			}
+		}
+		elem := cur
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct {
+			if sf, ok := elem.FieldByName(ident); ok {
+				cur = sf.Type
+				continue
+			}
+		}
+		return fmt.Errorf("template %s: %q has no field or method %q on %s", label, "."+strings.Join(field.Ident, "."), ident, typ)
+	}
+	return nil
+}
+
+// pageNameFromTemplateName extracts the page portion of a "layout:page",
+// ":page" or "page" template name, for looking up a registered type check.
+func pageNameFromTemplateName(templateName string) string {
+	if strings.HasPrefix(templateName, "_") {
+		return "" // blocks aren't checked against a page type
+	}
+	if i := strings.Index(templateName, ":"); i != -1 {
+		return templateName[i+1:]
+	}
+	return templateName
+}
+
+func methodResultType(m reflect.Method) reflect.Type {
+	if m.Type.NumOut() == 0 {
+		return nil
+	}
+	return m.Type.Out(0)
+}